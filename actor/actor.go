@@ -0,0 +1,547 @@
+package actor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/qumi/matrix/chanrpc"
+	"github.com/qumi/matrix/conf"
+	"github.com/qumi/matrix/log"
+	"github.com/qumi/matrix/timer"
+)
+
+var (
+	ErrExist   = errors.New("actor already exists")
+	ErrStopped = errors.New("actor stopped")
+	ErrClosed  = errors.New("actor system closed")
+)
+
+type id struct{}
+
+// the function id of actors on the chanrpc servers of their shards,
+// called with the Ref and the message
+var ID = id{}
+
+type control int
+
+const (
+	start control = iota
+	stop
+)
+
+// methods are called on the goroutine of the shard of the actor
+type Actor interface {
+	OnStart(ctx *Context)
+	// the result of Call, an error returned is the error of Call
+	Receive(ctx *Context, msg interface{}) interface{}
+	OnStop(ctx *Context)
+}
+
+// what to do with an actor after a panic
+type Directive int
+
+const (
+	Restart Directive = iota
+	Resume
+	Stop
+)
+
+// actors sharded across goroutines, actors of a shard are run one at a time
+//
+// goroutine safe
+type System struct {
+	// called on panics of actors, Restart when nil
+	//
+	// you must set the field before calling Spawn
+	Supervisor func(key interface{}, r interface{}) Directive
+
+	name   string
+	shards []*shard
+	wg     sync.WaitGroup
+}
+
+type shard struct {
+	system     *System
+	server     *chanrpc.Server
+	dispatcher *timer.Dispatcher
+	mutex      sync.RWMutex
+	actors     map[interface{}]*Ref
+	closed     bool
+	closeSig   chan bool
+
+	// the mailboxes of the actors of the shard
+	queueMutex sync.Mutex
+	ready      []*Ref
+	wake       chan bool
+	done       bool
+}
+
+// handle to an actor
+//
+// goroutine safe
+type Ref struct {
+	key   interface{}
+	shard *shard
+	ctx   *Context
+	// guarded by queueMutex of the shard, in ready when not empty
+	mailbox []*envelope
+}
+
+type envelope struct {
+	msg interface{}
+	// of Call, nil for Send
+	ctx context.Context
+	ret chan *reply
+}
+
+type reply struct {
+	ret interface{}
+	err error
+}
+
+// used on the goroutine of the shard only
+type Context struct {
+	ref      *Ref
+	newActor func() Actor
+	actor    Actor
+	timers  map[*timer.Timer]struct{}
+	crons   map[*timer.Cron]struct{}
+	started bool
+	stopped bool
+}
+
+// l is the length of the chanrpc and timer channels of each shard, shards
+// are monitored as name/i when name is not empty
+func NewSystem(name string, shards int, l int) *System {
+	if shards <= 0 {
+		shards = runtime.NumCPU()
+	}
+
+	sys := new(System)
+	sys.name = name
+	sys.shards = make([]*shard, shards)
+	for i := range sys.shards {
+		sh := new(shard)
+		sh.system = sys
+		sh.server = chanrpc.NewServer(l)
+		sh.server.Register(ID, sh.handle)
+		sh.dispatcher = timer.NewDispatcher(l)
+		sh.actors = make(map[interface{}]*Ref)
+		sh.closeSig = make(chan bool, 1)
+		sh.wake = make(chan bool, 1)
+		sys.shards[i] = sh
+
+		if name != "" {
+			err := chanrpc.Monitor(fmt.Sprintf("%v/%v", name, i), sh.server, nil)
+			if err != nil {
+				log.Error("actor system %v: %v", name, err)
+			}
+		}
+
+		sys.wg.Add(1)
+		go sh.run()
+	}
+	return sys
+}
+
+// stops the actors and their shards
+func (sys *System) Close() {
+	for i, sh := range sys.shards {
+		sh.mutex.Lock()
+		sh.closed = true
+		sh.mutex.Unlock()
+		sh.closeSig <- true
+
+		if sys.name != "" {
+			chanrpc.Unmonitor(fmt.Sprintf("%v/%v", sys.name, i))
+		}
+	}
+	sys.wg.Wait()
+}
+
+func (sys *System) shardOf(key interface{}) *shard {
+	var h uint64
+	switch k := key.(type) {
+	case int:
+		h = uint64(k)
+	case int32:
+		h = uint64(k)
+	case int64:
+		h = uint64(k)
+	case uint32:
+		h = uint64(k)
+	case uint64:
+		h = k
+	case string:
+		f := fnv.New64a()
+		f.Write([]byte(k))
+		h = f.Sum64()
+	default:
+		f := fnv.New64a()
+		fmt.Fprint(f, k)
+		h = f.Sum64()
+	}
+	return sys.shards[h%uint64(len(sys.shards))]
+}
+
+// OnStart is called before the messages sent after Spawn returns, a restart
+// runs a new actor of newActor
+func (sys *System) Spawn(key interface{}, newActor func() Actor) (*Ref, error) {
+	sh := sys.shardOf(key)
+	a := newActor()
+
+	sh.mutex.Lock()
+	if sh.closed {
+		sh.mutex.Unlock()
+		return nil, ErrClosed
+	}
+	if _, ok := sh.actors[key]; ok {
+		sh.mutex.Unlock()
+		return nil, ErrExist
+	}
+	ref := &Ref{key: key, shard: sh}
+	ref.ctx = &Context{ref: ref, newActor: newActor, actor: a}
+	sh.actors[key] = ref
+	sh.mutex.Unlock()
+
+	err := sh.post(ref, &envelope{msg: start})
+	if err != nil {
+		return nil, err
+	}
+	return ref, nil
+}
+
+func (sys *System) Lookup(key interface{}) (*Ref, bool) {
+	sh := sys.shardOf(key)
+
+	sh.mutex.RLock()
+	defer sh.mutex.RUnlock()
+	ref, ok := sh.actors[key]
+	return ref, ok
+}
+
+// messages sent before are received first, the key is free once the
+// function returns
+func (sys *System) Stop(key interface{}) bool {
+	ref, ok := sys.Lookup(key)
+	if !ok {
+		return false
+	}
+	return ref.shard.remove(ref)
+}
+
+func (sh *shard) remove(ref *Ref) bool {
+	sh.mutex.Lock()
+	if sh.actors[ref.key] != ref {
+		sh.mutex.Unlock()
+		return false
+	}
+	delete(sh.actors, ref.key)
+	sh.mutex.Unlock()
+
+	sh.post(ref, &envelope{msg: stop})
+	return true
+}
+
+// never blocks, so actors may send to actors of their shard
+func (sh *shard) post(ref *Ref, e *envelope) error {
+	sh.queueMutex.Lock()
+	if sh.done {
+		sh.queueMutex.Unlock()
+		return ErrClosed
+	}
+	if len(ref.mailbox) == 0 {
+		sh.ready = append(sh.ready, ref)
+	}
+	ref.mailbox = append(ref.mailbox, e)
+	sh.queueMutex.Unlock()
+
+	select {
+	case sh.wake <- true:
+	default:
+	}
+	return nil
+}
+
+// messages posted meanwhile are delivered on the next wake
+func (sh *shard) deliver() {
+	sh.queueMutex.Lock()
+	ready := sh.ready
+	sh.ready = nil
+	sh.queueMutex.Unlock()
+
+	for _, ref := range ready {
+		sh.receive(ref)
+	}
+}
+
+func (sh *shard) receive(ref *Ref) {
+	sh.queueMutex.Lock()
+	mailbox := ref.mailbox
+	ref.mailbox = nil
+	sh.queueMutex.Unlock()
+
+	for _, e := range mailbox {
+		if e.ret == nil {
+			ref.ctx.handle(e.msg)
+			continue
+		}
+
+		// canceled by the caller
+		if err := e.ctx.Err(); err != nil {
+			e.ret <- &reply{err: err}
+			continue
+		}
+		ret, err := result(ref.ctx.handle(e.msg), nil)
+		e.ret <- &reply{ret: ret, err: err}
+	}
+}
+
+// fails the calls queued
+func (sh *shard) drain() {
+	sh.queueMutex.Lock()
+	sh.done = true
+	ready := sh.ready
+	sh.ready = nil
+	for _, ref := range ready {
+		for _, e := range ref.mailbox {
+			if e.ret != nil {
+				e.ret <- &reply{err: ErrClosed}
+			}
+		}
+		ref.mailbox = nil
+	}
+	sh.queueMutex.Unlock()
+}
+
+func (sh *shard) run() {
+	defer sh.system.wg.Done()
+
+	for {
+		select {
+		case <-sh.closeSig:
+			sh.mutex.Lock()
+			refs := sh.actors
+			sh.actors = make(map[interface{}]*Ref)
+			sh.mutex.Unlock()
+
+			sh.drain()
+			sh.server.Close()
+			for _, ref := range refs {
+				ref.ctx.stop()
+			}
+			return
+		case <-sh.wake:
+			sh.deliver()
+		case ci := <-sh.server.ChanCall:
+			sh.server.Exec(ci)
+		case t := <-sh.dispatcher.ChanTimer:
+			t.Cb()
+		}
+	}
+}
+
+// calls on the chanrpc server of the shard are received after the messages
+// in the mailbox
+func (sh *shard) handle(args []interface{}) interface{} {
+	ref := args[0].(*Ref)
+	sh.receive(ref)
+	return ref.ctx.handle(args[1])
+}
+
+func (ctx *Context) handle(msg interface{}) interface{} {
+	if c, ok := msg.(control); ok {
+		switch c {
+		case start:
+			ctx.start()
+		case stop:
+			ctx.stop()
+		}
+		return nil
+	}
+
+	if ctx.stopped {
+		return ErrStopped
+	}
+	var ret interface{}
+	err := ctx.invoke(func() {
+		ret = ctx.actor.Receive(ctx, msg)
+	})
+	if err != nil {
+		return err
+	}
+	return ret
+}
+
+func (r *Ref) Key() interface{} {
+	return r.key
+}
+
+// the chanrpc server of the shard, the function ID takes the Ref and the
+// message, e.g. for AsynCall from a skeleton
+func (r *Ref) Server() *chanrpc.Server {
+	return r.shard.server
+}
+
+// queued in the mailbox of the actor, never blocks
+func (r *Ref) Send(msg interface{}) {
+	r.shard.post(r, &envelope{msg: msg})
+}
+
+// calling an actor of the same shard from an actor deadlocks, use Send
+func (r *Ref) Call(msg interface{}) (interface{}, error) {
+	return r.CallContext(context.Background(), msg)
+}
+
+func (r *Ref) CallContext(ctx context.Context, msg interface{}) (interface{}, error) {
+	e := &envelope{msg: msg, ctx: ctx, ret: make(chan *reply, 1)}
+	err := r.shard.post(r, e)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case rep := <-e.ret:
+		return rep.ret, rep.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func result(ret interface{}, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := ret.(error); ok {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (ctx *Context) Key() interface{} {
+	return ctx.ref.key
+}
+
+func (ctx *Context) Self() *Ref {
+	return ctx.ref
+}
+
+// OnStop is called after the current handler
+func (ctx *Context) Stop() {
+	ctx.ref.shard.remove(ctx.ref)
+}
+
+// stopped with the actor
+func (ctx *Context) AfterFunc(d time.Duration, cb func()) *timer.Timer {
+	if ctx.timers == nil {
+		ctx.timers = make(map[*timer.Timer]struct{})
+	}
+
+	var t *timer.Timer
+	t = ctx.ref.shard.dispatcher.AfterFunc(d, func() {
+		delete(ctx.timers, t)
+		ctx.invoke(cb)
+	})
+	ctx.timers[t] = struct{}{}
+	return t
+}
+
+// stopped with the actor
+func (ctx *Context) CronFunc(cronExpr *timer.CronExpr, cb func()) *timer.Cron {
+	if ctx.crons == nil {
+		ctx.crons = make(map[*timer.Cron]struct{})
+	}
+
+	c := ctx.ref.shard.dispatcher.CronFunc(cronExpr, func() {
+		ctx.invoke(cb)
+	})
+	ctx.crons[c] = struct{}{}
+	return c
+}
+
+func (ctx *Context) stopTimers() {
+	for t := range ctx.timers {
+		t.Stop()
+	}
+	for c := range ctx.crons {
+		c.Stop()
+	}
+	ctx.timers = nil
+	ctx.crons = nil
+}
+
+func (ctx *Context) start() {
+	if ctx.stopped {
+		return
+	}
+
+	ctx.started = true
+	if ctx.recover("OnStart", ctx.actor.OnStart) != nil {
+		ctx.Stop()
+	}
+}
+
+func (ctx *Context) stop() {
+	if ctx.stopped {
+		return
+	}
+	ctx.stopped = true
+	ctx.stopTimers()
+
+	if ctx.started {
+		ctx.recover("OnStop", ctx.actor.OnStop)
+	}
+}
+
+// runs f on the goroutine of the shard and supervises a panic
+func (ctx *Context) invoke(f func()) error {
+	if ctx.stopped {
+		return ErrStopped
+	}
+
+	r := ctx.recover("", func(*Context) { f() })
+	if r == nil {
+		return nil
+	}
+
+	d := Restart
+	if ctx.ref.shard.system.Supervisor != nil {
+		d = ctx.ref.shard.system.Supervisor(ctx.ref.key, r)
+	}
+	switch d {
+	case Restart:
+		ctx.stopTimers()
+		ctx.recover("OnStop", ctx.actor.OnStop)
+		// the state of the actor panicking is dropped
+		ctx.actor = ctx.newActor()
+		ctx.start()
+	case Stop:
+		ctx.Stop()
+	}
+	return fmt.Errorf("actor %v: %v", ctx.ref.key, r)
+}
+
+func (ctx *Context) recover(method string, f func(*Context)) (r interface{}) {
+	defer func() {
+		if r = recover(); r != nil {
+			if method != "" {
+				method = " " + method
+			}
+			if conf.LenStackBuf > 0 {
+				buf := make([]byte, conf.LenStackBuf)
+				l := runtime.Stack(buf, false)
+				log.Error("actor %v%v: %v: %s", ctx.ref.key, method, r, buf[:l])
+			} else {
+				log.Error("actor %v%v: %v", ctx.ref.key, method, r)
+			}
+		}
+	}()
+
+	f(ctx)
+	return nil
+}
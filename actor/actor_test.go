@@ -0,0 +1,49 @@
+package actor_test
+
+import (
+	"testing"
+
+	"github.com/qumi/matrix/actor"
+)
+
+type crashing struct {
+	n int
+}
+
+func (c *crashing) OnStart(ctx *actor.Context) {}
+func (c *crashing) OnStop(ctx *actor.Context)  {}
+
+func (c *crashing) Receive(ctx *actor.Context, msg interface{}) interface{} {
+	c.n++
+	if msg == "crash" {
+		panic("crash")
+	}
+	return c.n
+}
+
+func TestRestart(t *testing.T) {
+	sys := actor.NewSystem("", 1, 10)
+	defer sys.Close()
+
+	spawned := 0
+	ref, err := sys.Spawn(1, func() actor.Actor {
+		spawned++
+		return new(crashing)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref.Call("a")
+	if _, err := ref.Call("crash"); err == nil {
+		t.Fatal("panic not returned")
+	}
+	// the state before the panic is dropped
+	n, err := ref.Call("b")
+	if err != nil || n != 1 {
+		t.Fatalf("Call: %v %v, want 1", n, err)
+	}
+	if spawned != 2 {
+		t.Fatalf("%v actors made, want 2", spawned)
+	}
+}
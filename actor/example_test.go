@@ -0,0 +1,107 @@
+package actor_test
+
+import (
+	"fmt"
+	"github.com/qumi/matrix/actor"
+	"time"
+)
+
+type room struct {
+	players []string
+}
+
+func (r *room) OnStart(ctx *actor.Context) {
+	r.players = nil
+}
+
+func (r *room) Receive(ctx *actor.Context, msg interface{}) interface{} {
+	switch msg := msg.(type) {
+	case string:
+		r.players = append(r.players, msg)
+		return len(r.players)
+	case int:
+		// stops the room once the current handler returns
+		ctx.Stop()
+		return msg
+	case time.Duration:
+		done := make(chan bool)
+		ctx.AfterFunc(msg, func() {
+			fmt.Println("timeout", ctx.Key(), r.players)
+			close(done)
+		})
+		return done
+	}
+	return nil
+}
+
+func (r *room) OnStop(ctx *actor.Context) {
+	fmt.Println("close", ctx.Key())
+}
+
+func Example() {
+	sys := actor.NewSystem("", 4, 100)
+
+	newRoom := func() actor.Actor { return new(room) }
+	ref, _ := sys.Spawn(1, newRoom)
+	_, err := sys.Spawn(1, newRoom)
+	fmt.Println(err)
+
+	ref.Send("alice")
+	fmt.Println(ref.Call("bob"))
+
+	done, _ := ref.Call(10 * time.Millisecond)
+	<-done.(chan bool)
+
+	ref, _ = sys.Spawn(2, newRoom)
+	ref.Call(0)
+	_, err = ref.Call("carol")
+	fmt.Println(err)
+	_, ok := sys.Lookup(2)
+	fmt.Println(ok)
+
+	sys.Close()
+
+	// Output:
+	// actor already exists
+	// 2 <nil>
+	// timeout 1 [alice bob]
+	// close 2
+	// actor stopped
+	// false
+	// close 1
+}
+
+type counter struct {
+	n int
+}
+
+func (c *counter) OnStart(ctx *actor.Context) {}
+
+func (c *counter) Receive(ctx *actor.Context, msg interface{}) interface{} {
+	switch msg {
+	case "flood":
+		// more messages than the length of the channels of the shard
+		for i := 0; i < 100; i++ {
+			ctx.Self().Send(1)
+		}
+	case "count":
+		return c.n
+	default:
+		c.n += msg.(int)
+	}
+	return nil
+}
+
+func (c *counter) OnStop(ctx *actor.Context) {}
+
+func ExampleRef_Send() {
+	sys := actor.NewSystem("", 1, 1)
+	defer sys.Close()
+
+	ref, _ := sys.Spawn("counter", func() actor.Actor { return new(counter) })
+	ref.Call("flood")
+	fmt.Println(ref.Call("count"))
+
+	// Output:
+	// 100 <nil>
+}
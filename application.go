@@ -0,0 +1,161 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/qumi/matrix/cluster"
+	"github.com/qumi/matrix/console"
+	"github.com/qumi/matrix/log"
+	"github.com/qumi/matrix/module"
+)
+
+// a server embeddable in another process, Run is a thin wrapper
+//
+// an application owns its modules, console and cluster only. the conf
+// variables, logging (see log.Export), event.Default, the chanrpc stats and
+// the watchdog are process wide and shared by the applications of a process
+type Application struct {
+	// console listening address, no console when empty
+	ConsoleAddr   string
+	ConsolePrompt string
+	// the dialed and exported servers, closed by Stop. set it as the
+	// Cluster of the gates and select modes of the modules
+	Cluster *cluster.Cluster
+	Modules *module.Manager
+	// Stop gives up waiting after the timeout, 0 waits forever
+	ShutdownTimeout time.Duration
+
+	mutex         sync.Mutex
+	shutdownHooks hooks
+	reloadHooks   hooks
+	console       *console.Console
+	started       bool
+}
+
+// the application started by Run
+var Default = &Application{Modules: module.Default, Cluster: cluster.Default}
+
+func NewApplication(mods ...module.Module) *Application {
+	app := new(Application)
+	app.Modules = module.NewManager()
+	app.Cluster = cluster.New()
+	app.Register(mods...)
+	return app
+}
+
+// commands registered on the console before Start are served by the
+// console of the application only, e.g. as the Console of the skeletons
+func (app *Application) Console() *console.Console {
+	app.mutex.Lock()
+	defer app.mutex.Unlock()
+
+	if app.console == nil {
+		app.console = new(console.Console)
+	}
+	return app.console
+}
+
+// you must call the function before calling Start
+func (app *Application) Register(mods ...module.Module) {
+	for _, mi := range mods {
+		app.Modules.Register(mi)
+	}
+}
+
+func (app *Application) Start() error {
+	if app.started {
+		return errors.New("application already started")
+	}
+
+	log.Release("matrix %v starting up", version)
+
+	// module
+	err := app.Modules.Init()
+	if err != nil {
+		return err
+	}
+
+	// console
+	if app.ConsoleAddr != "" {
+		c := app.Console()
+		c.Addr = app.ConsoleAddr
+		c.Prompt = app.ConsolePrompt
+		c.Start()
+	}
+
+	app.started = true
+	return nil
+}
+
+// an error is returned when the shutdown exceeds ShutdownTimeout, the
+// modules are left stopping
+func (app *Application) Stop() error {
+	if !app.started {
+		return errors.New("application not started")
+	}
+	app.started = false
+
+	done := make(chan struct{})
+	go func() {
+		app.stop()
+		close(done)
+	}()
+
+	if app.ShutdownTimeout <= 0 {
+		<-done
+		return nil
+	}
+	t := time.NewTimer(app.ShutdownTimeout)
+	defer t.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-t.C:
+		return fmt.Errorf("shutdown exceeded %v", app.ShutdownTimeout)
+	}
+}
+
+func (app *Application) stop() {
+	app.mutex.Lock()
+	hs := app.shutdownHooks.sorted()
+	app.mutex.Unlock()
+	hs.run("shutdown")
+
+	if app.ConsoleAddr != "" {
+		app.Console().Close()
+	}
+	if app.Cluster != nil {
+		app.Cluster.Close()
+	}
+	app.Modules.Destroy()
+}
+
+// receives an error when a module exceeds its restart policy
+func (app *Application) Escalation() <-chan error {
+	return app.Modules.Escalation()
+}
+
+// starts the application and stops it once ctx is done or a module fails,
+// returning the failure
+func (app *Application) Run(ctx context.Context) error {
+	err := app.Start()
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		log.Release("matrix closing down (%v)", context.Cause(ctx))
+	case err = <-app.Escalation():
+		log.Error("matrix closing down (%v)", err)
+	}
+
+	if stopErr := app.Stop(); err == nil {
+		err = stopErr
+	}
+	return err
+}
@@ -0,0 +1,102 @@
+package matrix
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type idleModule struct {
+	closed chan bool
+}
+
+func (m *idleModule) OnInit()    {}
+func (m *idleModule) OnDestroy() {}
+
+func (m *idleModule) Run(closeSig chan bool) {
+	<-closeSig
+	close(m.closed)
+}
+
+func call(t *testing.T, addr string, line string) string {
+	var conn net.Conn
+	var err error
+	for i := 0; i < 50; i++ {
+		conn, err = net.Dial("tcp", addr)
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte(line + "\n"))
+	r := bufio.NewReader(conn)
+	out, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(out)
+}
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestApplications(t *testing.T) {
+	var apps []*Application
+	var mods []*idleModule
+	for _, name := range []string{"a", "b"} {
+		m := &idleModule{closed: make(chan bool)}
+		app := NewApplication(m)
+		app.ConsoleAddr = freeAddr(t)
+		name := name
+		app.Console().RegisterFunc("whoami", "name of the application", func([]string) string {
+			return name
+		})
+		err := app.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		apps = append(apps, app)
+		mods = append(mods, m)
+	}
+	defer apps[1].Stop()
+
+	if apps[0].Cluster == apps[1].Cluster {
+		t.Fatal("applications share a cluster")
+	}
+	for i, want := range []string{"a", "b"} {
+		if out := call(t, apps[i].ConsoleAddr, "whoami"); out != want {
+			t.Fatalf("console %v: %q, want %q", i, out, want)
+		}
+	}
+
+	err := apps[0].Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-mods[0].closed:
+	default:
+		t.Fatal("module of the stopped application running")
+	}
+	select {
+	case <-mods[1].closed:
+		t.Fatal("module of the other application stopped")
+	default:
+	}
+	if out := call(t, apps[1].ConsoleAddr, "whoami"); out != "b" {
+		t.Fatalf("console: %q, want %q", out, "b")
+	}
+}
@@ -1,11 +1,24 @@
 package chanrpc
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/qumi/matrix/conf"
 	"github.com/qumi/matrix/log"
 	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// returned by calls whose context deadline is exceeded
+var ErrTimeout = errors.New("chanrpc call timeout")
+
+// call states
+const (
+	callPending int32 = iota
+	callDone
+	callCanceled
 )
 
 // one server per goroutine (goroutine not safe)
@@ -17,15 +30,24 @@ type Server struct {
 	// func(args []interface{})
 	// func(args []interface{}) interface{}
 	// func(args []interface{}) []interface{}
-	functions map[interface{}]interface{}
-	ChanCall  chan *CallInfo
+	functions      map[interface{}]interface{}
+	ChanCall       chan *CallInfo
+	metrics        *metrics
+	slowCall       time.Duration
+	remote         RemoteFunc
+	name           string
+	owner          int64
+	detectDeadlock bool
 }
 
 type CallInfo struct {
+	id      interface{}
 	f       interface{}
 	args    []interface{}
 	chanRet chan *RetInfo
 	cb      interface{}
+	state   int32
+	stop    func() bool
 }
 
 type RetInfo struct {
@@ -45,13 +67,16 @@ type Client struct {
 	s               *Server
 	chanSyncRet     chan *RetInfo
 	ChanAsynRet     chan *RetInfo
-	pendingAsynCall int
+	pendingAsynCall int32
 }
 
 func NewServer(l int) *Server {
 	s := new(Server)
 	s.functions = make(map[interface{}]interface{})
 	s.ChanCall = make(chan *CallInfo, l)
+	s.metrics = newMetrics()
+	s.slowCall = conf.SlowCallThreshold
+	s.detectDeadlock = conf.DetectDeadlock
 	return s
 }
 
@@ -80,11 +105,24 @@ func (s *Server) Register(id interface{}, f interface{}) {
 	s.functions[id] = f
 }
 
+// you must call the function before calling Open and Go
+func (s *Server) Unregister(id interface{}) {
+	delete(s.functions, id)
+}
+
 func (s *Server) ret(ci *CallInfo, ri *RetInfo) (err error) {
 	if ci.chanRet == nil {
 		return
 	}
 
+	// canceled by the caller, the result is dropped
+	if !atomic.CompareAndSwapInt32(&ci.state, callPending, callDone) {
+		return
+	}
+	if ci.stop != nil {
+		ci.stop()
+	}
+
 	defer func() {
 		if r := recover(); r != nil {
 			err = r.(error)
@@ -107,6 +145,7 @@ func (s *Server) exec(ci *CallInfo) (err error) {
 				err = fmt.Errorf("%v", r)
 			}
 
+			s.metrics.panic(ci.id)
 			s.ret(ci, &RetInfo{err: fmt.Errorf("%v", r)})
 		}
 	}()
@@ -128,7 +167,17 @@ func (s *Server) exec(ci *CallInfo) (err error) {
 }
 
 func (s *Server) Exec(ci *CallInfo) {
+	s.Own()
+
+	// canceled before execution
+	if atomic.LoadInt32(&ci.state) == callCanceled {
+		s.metrics.cancel()
+		return
+	}
+
+	start := time.Now()
 	err := s.exec(ci)
+	s.record(ci, start)
 	if err != nil {
 		log.Error("%v", err)
 	}
@@ -136,7 +185,10 @@ func (s *Server) Exec(ci *CallInfo) {
 
 // goroutine safe
 func (s *Server) Go(id interface{}, args ...interface{}) {
-	f := s.functions[id]
+	var f interface{} = s.remote
+	if s.remote == nil {
+		f = s.functions[id]
+	}
 	if f == nil {
 		return
 	}
@@ -146,6 +198,7 @@ func (s *Server) Go(id interface{}, args ...interface{}) {
 	}()
 
 	s.ChanCall <- &CallInfo{
+		id:   id,
 		f:    f,
 		args: args,
 	}
@@ -166,6 +219,21 @@ func (s *Server) CallN(id interface{}, args ...interface{}) ([]interface{}, erro
 	return s.Open(0).CallN(id, args...)
 }
 
+// goroutine safe
+func (s *Server) Call0Context(ctx context.Context, id interface{}, args ...interface{}) error {
+	return s.Open(0).Call0Context(ctx, id, args...)
+}
+
+// goroutine safe
+func (s *Server) Call1Context(ctx context.Context, id interface{}, args ...interface{}) (interface{}, error) {
+	return s.Open(0).Call1Context(ctx, id, args...)
+}
+
+// goroutine safe
+func (s *Server) CallNContext(ctx context.Context, id interface{}, args ...interface{}) ([]interface{}, error) {
+	return s.Open(0).CallNContext(ctx, id, args...)
+}
+
 func (s *Server) Close() {
 	close(s.ChanCall)
 
@@ -219,6 +287,12 @@ func (c *Client) f(id interface{}, n int) (f interface{}, err error) {
 		return
 	}
 
+	// checked by the remote server
+	if c.s.remote != nil {
+		f = c.s.remote
+		return
+	}
+
 	f = c.s.functions[id]
 	if f == nil {
 		err = fmt.Errorf("function id %v: function not registered", id)
@@ -249,7 +323,14 @@ func (c *Client) Call0(id interface{}, args ...interface{}) error {
 		return err
 	}
 
+	release, err := wait(c.s)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	err = c.call(&CallInfo{
+		id:      id,
 		f:       f,
 		args:    args,
 		chanRet: c.chanSyncRet,
@@ -268,7 +349,14 @@ func (c *Client) Call1(id interface{}, args ...interface{}) (interface{}, error)
 		return nil, err
 	}
 
+	release, err := wait(c.s)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	err = c.call(&CallInfo{
+		id:      id,
 		f:       f,
 		args:    args,
 		chanRet: c.chanSyncRet,
@@ -287,7 +375,14 @@ func (c *Client) CallN(id interface{}, args ...interface{}) ([]interface{}, erro
 		return nil, err
 	}
 
+	release, err := wait(c.s)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	err = c.call(&CallInfo{
+		id:      id,
 		f:       f,
 		args:    args,
 		chanRet: c.chanSyncRet,
@@ -300,26 +395,129 @@ func (c *Client) CallN(id interface{}, args ...interface{}) ([]interface{}, erro
 	return assert(ri.ret), ri.err
 }
 
-func (c *Client) asynCall(id interface{}, args []interface{}, cb interface{}, n int) {
+func contextErr(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return ErrTimeout
+	}
+	return ctx.Err()
+}
+
+func (c *Client) callContext(ctx context.Context, id interface{}, args []interface{}, n int) (*RetInfo, error) {
+	f, err := c.f(id, n)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := wait(c.s)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// a late result must not reach the next call, so no chanSyncRet
+	ci := &CallInfo{
+		id:      id,
+		f:       f,
+		args:    args,
+		chanRet: make(chan *RetInfo, 1),
+	}
+
+	err = func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = r.(error)
+			}
+		}()
+
+		select {
+		case c.s.ChanCall <- ci:
+		case <-ctx.Done():
+			err = contextErr(ctx)
+		}
+		return
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case ri := <-ci.chanRet:
+		return ri, nil
+	case <-ctx.Done():
+		if atomic.CompareAndSwapInt32(&ci.state, callPending, callCanceled) {
+			return nil, contextErr(ctx)
+		}
+		return <-ci.chanRet, nil
+	}
+}
+
+func (c *Client) Call0Context(ctx context.Context, id interface{}, args ...interface{}) error {
+	ri, err := c.callContext(ctx, id, args, 0)
+	if err != nil {
+		return err
+	}
+	return ri.err
+}
+
+func (c *Client) Call1Context(ctx context.Context, id interface{}, args ...interface{}) (interface{}, error) {
+	ri, err := c.callContext(ctx, id, args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return ri.ret, ri.err
+}
+
+func (c *Client) CallNContext(ctx context.Context, id interface{}, args ...interface{}) ([]interface{}, error) {
+	ri, err := c.callContext(ctx, id, args, 2)
+	if err != nil {
+		return nil, err
+	}
+	return assert(ri.ret), ri.err
+}
+
+func (c *Client) asynCall(ctx context.Context, id interface{}, args []interface{}, cb interface{}, n int) {
 	f, err := c.f(id, n)
 	if err != nil {
 		c.ChanAsynRet <- &RetInfo{err: err, cb: cb}
 		return
 	}
 
-	err = c.call(&CallInfo{
+	ci := &CallInfo{
+		id:      id,
 		f:       f,
 		args:    args,
 		chanRet: c.ChanAsynRet,
 		cb:      cb,
-	}, false)
+	}
+
+	// exactly one of the result and the cancellation reaches ChanAsynRet
+	if ctx.Done() != nil {
+		ci.stop = context.AfterFunc(ctx, func() {
+			if atomic.CompareAndSwapInt32(&ci.state, callPending, callCanceled) {
+				c.ChanAsynRet <- &RetInfo{err: contextErr(ctx), cb: cb}
+			}
+		})
+	}
+
+	err = c.call(ci, false)
 	if err != nil {
-		c.ChanAsynRet <- &RetInfo{err: err, cb: cb}
+		if atomic.CompareAndSwapInt32(&ci.state, callPending, callDone) {
+			if ci.stop != nil {
+				ci.stop()
+			}
+			c.ChanAsynRet <- &RetInfo{err: err, cb: cb}
+		}
 		return
 	}
 }
 
 func (c *Client) AsynCall(id interface{}, _args ...interface{}) {
+	c.AsynCallContext(context.Background(), id, _args...)
+}
+
+// the callback is called with ErrTimeout or the context error when ctx is
+// done before the result, a late result is dropped
+func (c *Client) AsynCallContext(ctx context.Context, id interface{}, _args ...interface{}) {
 	if len(_args) < 1 {
 		panic("callback function not found")
 	}
@@ -340,13 +538,33 @@ func (c *Client) AsynCall(id interface{}, _args ...interface{}) {
 	}
 
 	// too many calls
-	if c.pendingAsynCall >= cap(c.ChanAsynRet) {
+	if int(c.pendingAsynCall) >= cap(c.ChanAsynRet) {
 		execCb(&RetInfo{err: errors.New("too many calls"), cb: cb})
 		return
 	}
 
-	c.asynCall(id, args, cb, n)
-	c.pendingAsynCall++
+	c.asynCall(ctx, id, args, cb, n)
+	atomic.AddInt32(&c.pendingAsynCall, 1)
+}
+
+// the callback gets nil, interface{} or []interface{} according to
+// the definition of the function
+func (c *Client) AsynCallAny(ctx context.Context, id interface{}, args []interface{}, cb func(ret interface{}, err error)) {
+	var _cb interface{} = cb
+	if c.s != nil && c.s.remote == nil {
+		switch c.s.functions[id].(type) {
+		case func([]interface{}):
+			_cb = func(err error) {
+				cb(nil, err)
+			}
+		case func([]interface{}) []interface{}:
+			_cb = func(ret []interface{}, err error) {
+				cb(ret, err)
+			}
+		}
+	}
+
+	c.AsynCallContext(ctx, id, append(args[:len(args):len(args)], _cb)...)
 }
 
 func execCb(ri *RetInfo) {
@@ -377,7 +595,7 @@ func execCb(ri *RetInfo) {
 }
 
 func (c *Client) Cb(ri *RetInfo) {
-	c.pendingAsynCall--
+	atomic.AddInt32(&c.pendingAsynCall, -1)
 	execCb(ri)
 }
 
@@ -390,3 +608,8 @@ func (c *Client) Close() {
 func (c *Client) Idle() bool {
 	return c.pendingAsynCall == 0
 }
+
+// goroutine safe
+func (c *Client) Pending() int {
+	return int(atomic.LoadInt32(&c.pendingAsynCall))
+}
@@ -0,0 +1,89 @@
+package chanrpc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/qumi/matrix/log"
+	"github.com/qumi/matrix/util"
+)
+
+// returned by synchronous calls which would wait for the calling goroutine
+var ErrDeadlock = errors.New("chanrpc call deadlock")
+
+// goroutine -> server it is waiting for in a synchronous call
+var waiting struct {
+	sync.Mutex
+	servers map[int64]*Server
+}
+
+func (s *Server) String() string {
+	if s.name != "" {
+		return s.name
+	}
+	return fmt.Sprintf("%p", s)
+}
+
+// synchronous calls to the server fail with ErrDeadlock when the goroutine
+// executing it waits (directly or not) for the calling goroutine, servers
+// in the cycle must all be detecting
+//
+// you must call the function before calling Open and Go
+func (s *Server) SetDetectDeadlock(detect bool) {
+	s.detectDeadlock = detect
+}
+
+// called by the goroutine executing the server before its loop, so cycles
+// are detected before the first call is executed. Exec calls it too
+func (s *Server) Own() {
+	if s.detectDeadlock {
+		atomic.StoreInt64(&s.owner, util.GoroutineID())
+	}
+}
+
+// records the calling goroutine waiting for s, fails when the goroutine
+// executing s waits (directly or not) for the calling goroutine
+func wait(s *Server) (release func(), err error) {
+	if !s.detectDeadlock {
+		return func() {}, nil
+	}
+
+	g := util.GoroutineID()
+
+	waiting.Lock()
+	defer waiting.Unlock()
+
+	path := []string{s.String()}
+	for t := s; ; {
+		o := atomic.LoadInt64(&t.owner)
+		if o == 0 {
+			break
+		}
+		if o == g {
+			log.Error("chanrpc deadlock: goroutine %v -> %v -> goroutine %v",
+				g, strings.Join(path, " -> "), g)
+			return nil, ErrDeadlock
+		}
+
+		next, ok := waiting.servers[o]
+		if !ok || len(path) > len(waiting.servers) {
+			break
+		}
+		t = next
+		path = append(path, t.String())
+	}
+
+	if waiting.servers == nil {
+		waiting.servers = make(map[int64]*Server)
+	}
+	waiting.servers[g] = s
+
+	return func() {
+		waiting.Lock()
+		delete(waiting.servers, g)
+		waiting.Unlock()
+	}, nil
+}
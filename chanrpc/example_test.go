@@ -1,9 +1,11 @@
 package chanrpc_test
 
 import (
+	"context"
 	"fmt"
 	"github.com/qumi/matrix/chanrpc"
 	"sync"
+	"time"
 )
 
 func Example() {
@@ -125,3 +127,208 @@ func Example() {
 	// 1 2 3
 	// 3
 }
+
+func ExampleClient_Call1Context() {
+	s := chanrpc.NewServer(10)
+	s.Register("f1", func(args []interface{}) interface{} {
+		return 1
+	})
+
+	c := s.Open(10)
+
+	// the server goroutine is not running
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := c.Call1Context(ctx, "f1")
+	fmt.Println(err)
+
+	// canceled calls are skipped by the server
+	s.Exec(<-s.ChanCall)
+
+	go func() {
+		s.Exec(<-s.ChanCall)
+	}()
+	r1, err := c.Call1Context(context.Background(), "f1")
+	fmt.Println(r1, err)
+
+	// asyn
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c.AsynCallContext(ctx, "f1", func(ret interface{}, err error) {
+		fmt.Println(ret, err)
+	})
+	c.Cb(<-c.ChanAsynRet)
+
+	// Output:
+	// chanrpc call timeout
+	// 1 <nil>
+	// <nil> chanrpc call timeout
+}
+
+type addReq struct {
+	N1, N2 int
+}
+
+func ExampleRegister() {
+	s := chanrpc.NewServer(10)
+	add := chanrpc.Register(s, "add", func(req addReq) int {
+		return req.N1 + req.N2
+	})
+
+	go func() {
+		for ci := range s.ChanCall {
+			s.Exec(ci)
+		}
+	}()
+	defer s.Close()
+
+	// sync
+	sum, err := chanrpc.Call(add, addReq{1, 2})
+	fmt.Println(sum, err)
+
+	// asyn
+	c := chanrpc.NewClient(10)
+	chanrpc.AsynCall(c, add, addReq{3, 4}, func(sum int, err error) {
+		fmt.Println(sum, err)
+	})
+	c.Cb(<-c.ChanAsynRet)
+
+	// Output:
+	// 3 <nil>
+	// 7 <nil>
+}
+
+func ExampleServer_Stats() {
+	s := chanrpc.NewServer(10)
+	s.Register("f0", func(args []interface{}) {})
+	s.Register("panic", func(args []interface{}) {
+		panic("bug")
+	})
+
+	s.Go("f0")
+	s.Go("f0")
+	s.Go("panic")
+	fmt.Println(s.Stats().QueueLen)
+
+	s.Exec(<-s.ChanCall)
+	s.Exec(<-s.ChanCall)
+	s.Exec(<-s.ChanCall)
+
+	st := s.Stats()
+	fmt.Println(st.QueueLen, st.Calls, st.Panics)
+	for _, f := range st.Funcs {
+		fmt.Println(f.ID, f.Calls, f.Panics)
+	}
+
+	// Output:
+	// 3
+	// 0 3 1
+	// f0 2 0
+	// panic 1 1
+}
+
+func ExampleServer_Stats_canceled() {
+	s := chanrpc.NewServer(10)
+	s.Register("f0", func(args []interface{}) {})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	err := s.Call0Context(ctx, "f0")
+	fmt.Println(err)
+
+	// not executed
+	s.Exec(<-s.ChanCall)
+	st := s.Stats()
+	fmt.Println(st.Calls, st.Canceled)
+
+	// Output:
+	// chanrpc call timeout
+	// 0 1
+}
+
+func ExampleNewRemoteServer() {
+	// forwards calls to another goroutine, e.g. over the network
+	s := chanrpc.NewRemoteServer(10, func(id interface{}, args []interface{}, cb func(interface{}, error)) {
+		go func() {
+			if id != "add" {
+				cb(nil, fmt.Errorf("function id %v: function not registered", id))
+				return
+			}
+			cb(args[0].(int)+args[1].(int), nil)
+		}()
+	})
+	defer s.Close()
+
+	c := s.Open(10)
+	ra, err := c.Call1("add", 1, 2)
+	fmt.Println(ra, err)
+
+	c.AsynCall("sub", 1, 2, func(ret interface{}, err error) {
+		fmt.Println(ret, err)
+	})
+	c.Cb(<-c.ChanAsynRet)
+
+	// Output:
+	// 3 <nil>
+	// <nil> function id sub: function not registered
+}
+
+func Example_deadlock() {
+	a := chanrpc.NewServer(10)
+	a.SetDetectDeadlock(true)
+	b := chanrpc.NewServer(10)
+	b.SetDetectDeadlock(true)
+
+	a.Register("a", func(args []interface{}) interface{} {
+		ret, err := b.Call1("b")
+		if err != nil {
+			return err.Error()
+		}
+		return ret
+	})
+	a.Register("ping", func(args []interface{}) {})
+	b.Register("b", func(args []interface{}) interface{} {
+		// a is waiting for b
+		return a.Call0("ping")
+	})
+
+	for _, s := range []*chanrpc.Server{a, b} {
+		go func(s *chanrpc.Server) {
+			for ci := range s.ChanCall {
+				s.Exec(ci)
+			}
+		}(s)
+	}
+
+	ret, err := a.Call1("a")
+	fmt.Println(ret, err)
+
+	// Output:
+	// chanrpc call deadlock <nil>
+}
+
+func ExampleServer_Own() {
+	a := chanrpc.NewServer(10)
+	a.SetDetectDeadlock(true)
+	b := chanrpc.NewServer(10)
+	b.SetDetectDeadlock(true)
+
+	a.Register("ping", func(args []interface{}) {})
+	b.Register("b", func(args []interface{}) interface{} {
+		// the goroutine of a is waiting for b
+		return a.Call0("ping")
+	})
+	go func() {
+		for ci := range b.ChanCall {
+			b.Exec(ci)
+		}
+	}()
+
+	// e.g. a timer of the goroutine of a, before a executes any call
+	a.Own()
+	ret, err := b.Call1("b")
+	fmt.Println(ret, err)
+
+	// Output:
+	// chanrpc call deadlock <nil>
+}
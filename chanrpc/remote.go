@@ -0,0 +1,62 @@
+package chanrpc
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// executes a call of a remote server, cb may be called on any goroutine
+type RemoteFunc func(id interface{}, args []interface{}, cb func(ret interface{}, err error))
+
+// a server whose calls are forwarded by call, e.g. to another process,
+// the results are delivered to the calling clients as usual
+func NewRemoteServer(l int, call RemoteFunc) *Server {
+	s := NewServer(l)
+	s.remote = call
+
+	go func() {
+		for ci := range s.ChanCall {
+			s.forward(ci)
+		}
+	}()
+
+	return s
+}
+
+func (s *Server) forward(ci *CallInfo) {
+	// canceled before forwarding
+	if atomic.LoadInt32(&ci.state) == callCanceled {
+		return
+	}
+
+	s.remote(ci.id, ci.args, func(ret interface{}, err error) {
+		s.ret(ci, &RetInfo{ret: ret, err: err})
+	})
+}
+
+// calls the function whatever its definition, the result is nil,
+// interface{} or []interface{}
+//
+// goroutine safe
+func (s *Server) CallContext(ctx context.Context, id interface{}, args ...interface{}) (interface{}, error) {
+	n := 1
+	if s.remote == nil {
+		switch s.functions[id].(type) {
+		case func([]interface{}):
+			n = 0
+		case func([]interface{}) interface{}:
+			n = 1
+		case func([]interface{}) []interface{}:
+			n = 2
+		default:
+			return nil, fmt.Errorf("function id %v: function not registered", id)
+		}
+	}
+
+	ri, err := s.Open(0).callContext(ctx, id, args, n)
+	if err != nil {
+		return nil, err
+	}
+	return ri.ret, ri.err
+}
@@ -0,0 +1,257 @@
+package chanrpc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qumi/matrix/log"
+)
+
+// execution time samples kept per function id
+const lenSamples = 1024
+
+// max length of an argument in slow call logs
+const lenArgSummary = 64
+
+type FuncStats struct {
+	ID     interface{}
+	Calls  uint64
+	Panics uint64
+	P50    time.Duration
+	P99    time.Duration
+	Max    time.Duration
+}
+
+type Stats struct {
+	Name            string
+	QueueLen        int
+	QueueCap        int
+	PendingAsynCall int
+	Calls           uint64
+	Panics          uint64
+	CallsPerSec     float64
+	Funcs           []*FuncStats
+	// canceled by the callers before execution, not in Calls
+	Canceled uint64
+}
+
+type funcMetrics struct {
+	calls   uint64
+	panics  uint64
+	max     time.Duration
+	samples []time.Duration
+}
+
+type metrics struct {
+	sync.Mutex
+	calls       uint64
+	panics      uint64
+	canceled    uint64
+	windowStart time.Time
+	windowCalls uint64
+	rate        float64
+	funcs       map[interface{}]*funcMetrics
+}
+
+func newMetrics() *metrics {
+	m := new(metrics)
+	m.windowStart = time.Now()
+	m.funcs = make(map[interface{}]*funcMetrics)
+	return m
+}
+
+func (m *metrics) get(id interface{}) *funcMetrics {
+	fm, ok := m.funcs[id]
+	if !ok {
+		fm = new(funcMetrics)
+		m.funcs[id] = fm
+	}
+	return fm
+}
+
+func (m *metrics) record(id interface{}, now time.Time, d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.calls++
+	m.windowCalls++
+	if elapsed := now.Sub(m.windowStart); elapsed >= time.Second {
+		m.rate = float64(m.windowCalls) / elapsed.Seconds()
+		m.windowStart = now
+		m.windowCalls = 0
+	}
+
+	fm := m.get(id)
+	if len(fm.samples) < lenSamples {
+		fm.samples = append(fm.samples, d)
+	} else {
+		fm.samples[fm.calls%lenSamples] = d
+	}
+	fm.calls++
+	if d > fm.max {
+		fm.max = d
+	}
+}
+
+func (m *metrics) panic(id interface{}) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.panics++
+	m.get(id).panics++
+}
+
+func (m *metrics) cancel() {
+	m.Lock()
+	defer m.Unlock()
+
+	m.canceled++
+}
+
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[(len(sorted)-1)*p/100]
+}
+
+func (m *metrics) stats(s *Stats) {
+	m.Lock()
+	defer m.Unlock()
+
+	s.Calls = m.calls
+	s.Panics = m.panics
+	s.Canceled = m.canceled
+	s.CallsPerSec = m.rate
+	// idle since the last window
+	if elapsed := time.Since(m.windowStart); elapsed >= 2*time.Second {
+		s.CallsPerSec = float64(m.windowCalls) / elapsed.Seconds()
+	}
+
+	for id, fm := range m.funcs {
+		sorted := make([]time.Duration, len(fm.samples))
+		copy(sorted, fm.samples)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+		s.Funcs = append(s.Funcs, &FuncStats{
+			ID:     id,
+			Calls:  fm.calls,
+			Panics: fm.panics,
+			P50:    percentile(sorted, 50),
+			P99:    percentile(sorted, 99),
+			Max:    fm.max,
+		})
+	}
+	sort.Slice(s.Funcs, func(i, j int) bool {
+		return fmt.Sprint(s.Funcs[i].ID) < fmt.Sprint(s.Funcs[j].ID)
+	})
+}
+
+// calls executing longer than d are logged with their id and arguments,
+// 0 disables the logging
+//
+// you must call the function before calling Open and Go
+func (s *Server) SetSlowCallThreshold(d time.Duration) {
+	s.slowCall = d
+}
+
+// goroutine safe
+func (s *Server) Stats() *Stats {
+	st := new(Stats)
+	st.QueueLen = len(s.ChanCall)
+	st.QueueCap = cap(s.ChanCall)
+	s.metrics.stats(st)
+	return st
+}
+
+func (s *Server) record(ci *CallInfo, start time.Time) {
+	now := time.Now()
+	d := now.Sub(start)
+	s.metrics.record(ci.id, now, d)
+
+	if s.slowCall > 0 && d >= s.slowCall {
+		log.Release("chanrpc slow call %v: %v, args: %v", ci.id, d, summary(ci.args))
+	}
+}
+
+func summary(args []interface{}) string {
+	ss := make([]string, len(args))
+	for i, arg := range args {
+		s := fmt.Sprintf("%v", arg)
+		if len(s) > lenArgSummary {
+			s = s[:lenArgSummary] + "..."
+		}
+		ss[i] = s
+	}
+	return "[" + strings.Join(ss, ", ") + "]"
+}
+
+var monitors struct {
+	sync.Mutex
+	names   []string
+	servers map[string]*Server
+	clients map[string]*Client
+}
+
+// makes the server (and the client, may be nil) stats queryable by name,
+// fails when the name is taken by another server
+//
+// goroutine safe
+func Monitor(name string, s *Server, c *Client) error {
+	monitors.Lock()
+	defer monitors.Unlock()
+
+	if monitors.servers == nil {
+		monitors.servers = make(map[string]*Server)
+		monitors.clients = make(map[string]*Client)
+	}
+	if old, ok := monitors.servers[name]; !ok {
+		monitors.names = append(monitors.names, name)
+	} else if old != s {
+		return fmt.Errorf("chanrpc server %v: already monitored", name)
+	}
+	monitors.servers[name] = s
+	monitors.clients[name] = c
+	s.name = name
+	return nil
+}
+
+// goroutine safe
+func Unmonitor(name string) {
+	monitors.Lock()
+	defer monitors.Unlock()
+
+	if _, ok := monitors.servers[name]; !ok {
+		return
+	}
+	delete(monitors.servers, name)
+	delete(monitors.clients, name)
+	for i, n := range monitors.names {
+		if n == name {
+			monitors.names = append(monitors.names[:i], monitors.names[i+1:]...)
+			break
+		}
+	}
+}
+
+// stats of all monitored servers, in monitoring order
+//
+// goroutine safe
+func MonitoredStats() []*Stats {
+	monitors.Lock()
+	defer monitors.Unlock()
+
+	var stats []*Stats
+	for _, name := range monitors.names {
+		st := monitors.servers[name].Stats()
+		st.Name = name
+		if c := monitors.clients[name]; c != nil {
+			st.PendingAsynCall = c.Pending()
+		}
+		stats = append(stats, st)
+	}
+	return stats
+}
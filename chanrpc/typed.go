@@ -0,0 +1,59 @@
+package chanrpc
+
+import (
+	"context"
+)
+
+// a function registered by Register, binding the server, the id and
+// the request and response types
+type Func[Req, Resp any] struct {
+	s  *Server
+	id interface{}
+}
+
+func (fn Func[Req, Resp]) Server() *Server {
+	return fn.s
+}
+
+func (fn Func[Req, Resp]) ID() interface{} {
+	return fn.id
+}
+
+// you must call the function before calling Open and Go
+func Register[Req, Resp any](s *Server, id interface{}, f func(Req) Resp) Func[Req, Resp] {
+	s.Register(id, func(args []interface{}) interface{} {
+		return f(args[0].(Req))
+	})
+	return Func[Req, Resp]{s: s, id: id}
+}
+
+func resp[Resp any](ret interface{}, err error) (Resp, error) {
+	var r Resp
+	if err == nil && ret != nil {
+		r = ret.(Resp)
+	}
+	return r, err
+}
+
+// goroutine safe
+func Call[Req, Resp any](fn Func[Req, Resp], req Req) (Resp, error) {
+	return resp[Resp](fn.s.Call1(fn.id, req))
+}
+
+// goroutine safe
+func CallContext[Req, Resp any](ctx context.Context, fn Func[Req, Resp], req Req) (Resp, error) {
+	return resp[Resp](fn.s.Call1Context(ctx, fn.id, req))
+}
+
+// c is attached to the server of fn, cb is called by c.Cb
+func AsynCall[Req, Resp any](c *Client, fn Func[Req, Resp], req Req, cb func(Resp, error)) {
+	AsynCallContext(context.Background(), c, fn, req, cb)
+}
+
+// c is attached to the server of fn, cb is called by c.Cb
+func AsynCallContext[Req, Resp any](ctx context.Context, c *Client, fn Func[Req, Resp], req Req, cb func(Resp, error)) {
+	c.Attach(fn.s)
+	c.AsynCallContext(ctx, fn.id, req, func(ret interface{}, err error) {
+		cb(resp[Resp](ret, err))
+	})
+}
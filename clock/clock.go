@@ -0,0 +1,183 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// goroutine safe
+type Clock interface {
+	Now() time.Time
+	// f is called on its own goroutine, or the one advancing a Fake
+	AfterFunc(d time.Duration, f func()) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+type Timer interface {
+	Stop() bool
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// the clock of the time package
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// a clock moved by Advance and Set only, timers due are fired in time order
+// on the goroutine moving the clock
+//
+// goroutine safe
+type Fake struct {
+	mutex  sync.Mutex
+	now    time.Time
+	seq    uint64
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock  *Fake
+	when   time.Time
+	seq    uint64
+	period time.Duration
+	f      func()
+	c      chan time.Time
+}
+
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (c *Fake) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *Fake) AfterFunc(d time.Duration, f func()) Timer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	t := &fakeTimer{clock: c, f: f}
+	c.add(t, c.now.Add(d))
+	return t
+}
+
+func (c *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	t := &fakeTimer{clock: c, period: d, c: make(chan time.Time, 1)}
+	c.add(t, c.now.Add(d))
+	return fakeTicker{t}
+}
+
+func (c *Fake) add(t *fakeTimer, when time.Time) {
+	c.seq++
+	t.when = when
+	t.seq = c.seq
+	c.timers = append(c.timers, t)
+	sort.Slice(c.timers, func(i, j int) bool {
+		if c.timers[i].when.Equal(c.timers[j].when) {
+			return c.timers[i].seq < c.timers[j].seq
+		}
+		return c.timers[i].when.Before(c.timers[j].when)
+	})
+}
+
+func (c *Fake) remove(t *fakeTimer) bool {
+	for i, _t := range c.timers {
+		if _t == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// the callbacks of AfterFunc run on the calling goroutine in time order, so
+// they must not block (the timers of timer.Dispatcher do not), and ticks
+// are dropped when the receiver lags behind
+func (c *Fake) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// a time before now only fires the timers due
+func (c *Fake) Set(now time.Time) {
+	for {
+		c.mutex.Lock()
+		if len(c.timers) == 0 || c.timers[0].when.After(now) {
+			if now.After(c.now) {
+				c.now = now
+			}
+			c.mutex.Unlock()
+			return
+		}
+
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		if t.when.After(c.now) {
+			c.now = t.when
+		}
+		if t.period > 0 {
+			c.add(t, t.when.Add(t.period))
+		}
+		c.mutex.Unlock()
+
+		if t.c != nil {
+			// dropped when the receiver lags behind, as time.Ticker
+			select {
+			case t.c <- t.when:
+			default:
+			}
+		} else {
+			t.f()
+		}
+	}
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	return t.clock.remove(t)
+}
+
+type fakeTicker struct {
+	*fakeTimer
+}
+
+func (t fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
@@ -0,0 +1,64 @@
+package clock_test
+
+import (
+	"fmt"
+	"github.com/qumi/matrix/clock"
+	"github.com/qumi/matrix/timer"
+	"time"
+)
+
+func ExampleFake() {
+	c := clock.NewFake(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	d := timer.NewDispatcherClock(10, c)
+
+	d.AfterFunc(time.Hour, func() {
+		fmt.Println("buff expired")
+	})
+	cronExpr, _ := timer.NewCronExpr("@daily")
+	d.CronFunc(cronExpr, func() {
+		fmt.Println("daily reset", d.Now())
+	})
+
+	c.Advance(30 * time.Minute)
+	fmt.Println(len(d.ChanTimer))
+
+	for i := 0; i < 2; i++ {
+		c.Advance(24 * time.Hour)
+		for len(d.ChanTimer) > 0 {
+			(<-d.ChanTimer).Cb()
+		}
+	}
+
+	// Output:
+	// 0
+	// buff expired
+	// daily reset 2000-01-02 00:30:00 +0000 UTC
+	// daily reset 2000-01-03 00:30:00 +0000 UTC
+}
+
+func ExampleFake_Advance() {
+	c := clock.NewFake(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	d := timer.NewDispatcherClock(1, c)
+
+	for i := 1; i <= 3; i++ {
+		i := i
+		d.AfterFunc(time.Duration(i)*time.Second, func() {
+			fmt.Println("timer", i)
+		})
+	}
+
+	// does not block on the full ChanTimer
+	c.Advance(time.Minute)
+	n := 0
+	for t := range d.ChanTimer {
+		t.Cb()
+		if n++; n == 3 {
+			break
+		}
+	}
+
+	// Output:
+	// timer 1
+	// timer 2
+	// timer 3
+}
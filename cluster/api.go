@@ -2,9 +2,11 @@ package cluster
 
 import (
 	"fmt"
+	"github.com/qumi/matrix/chanrpc"
 	"github.com/qumi/matrix/network"
 	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 	//"github.com/qumi/matrix/log"
 	"math/rand"
@@ -16,50 +18,133 @@ const typeLength = 2
 // client_agent保留内存时间
 const retainTime = time.Hour * 12
 
-var (
+// the servers dialed by a hall and the servers exported by a game server
+//
+// goroutine safe
+type Cluster struct {
 	// servertype -> serverId -> agent
 	lock    sync.RWMutex
 	clients map[uint16]map[uint16]*ClusterClientAgent
-)
+	// changed when servers are dialed or removed
+	version uint64
+
+	// serverType -> the mode of FindClusterClientAgent
+	hashModes map[uint16]*ConsistentHashSelectMode
+
+	exportLock sync.RWMutex
+	exports    map[string]*chanrpc.Server
+
+	remoteLock sync.Mutex
+	remotes    map[remoteKey]*chanrpc.Server
+}
 
-func init() {
-	clients = make(map[uint16]map[uint16]*ClusterClientAgent)
+// the cluster of the package functions, and of gates and select modes
+// without one
+var Default = New()
+
+func New() *Cluster {
+	c := new(Cluster)
+	c.clients = make(map[uint16]map[uint16]*ClusterClientAgent)
+	c.hashModes = make(map[uint16]*ConsistentHashSelectMode)
+	c.exports = make(map[string]*chanrpc.Server)
+	c.remotes = make(map[remoteKey]*chanrpc.Server)
+	return c
+}
+
+func orDefault(c *Cluster) *Cluster {
+	if c == nil {
+		return Default
+	}
+	return c
 }
 
 func Init() {
 }
 
 func FetchAgent(conn *network.TCPConn, serverType uint16, serverId uint16, client *ClusterTCPClient) network.Agent {
-	lock.Lock()
-	defer lock.Unlock()
-	a := clients[serverType][serverId]
+	return Default.FetchAgent(conn, serverType, serverId, client)
+}
+
+func (c *Cluster) FetchAgent(conn *network.TCPConn, serverType uint16, serverId uint16, client *ClusterTCPClient) network.Agent {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	a := c.clients[serverType][serverId]
 	a.c = client
 	a.conn = conn
 	return a
 }
 
-// use in hall
+// removes the servers dialed
+func (c *Cluster) Close() {
+	c.lock.RLock()
+	var keys []serverKey
+	for serverType, m := range c.clients {
+		for serverId := range m {
+			keys = append(keys, serverKey{serverType, serverId})
+		}
+	}
+	c.lock.RUnlock()
+
+	for _, k := range keys {
+		c.RemoveServer(k.serverType, k.serverId)
+	}
+}
+
+// use in hall, closes the connection to the server. its HallClientAgents
+// are notified by OnClusterClientAgentClose and select another server on
+// the next message
 func RemoveServer(serverType uint16, serverId uint16) {
+	Default.RemoveServer(serverType, serverId)
+}
 
+func (c *Cluster) RemoveServer(serverType uint16, serverId uint16) {
+	c.lock.RLock()
+	a := c.clients[serverType][serverId]
+	c.lock.RUnlock()
+	if a == nil {
+		return
+	}
+
+	atomic.StoreInt32(&a.removed, 1)
+	// FetchAgent finds the agent until the client is closed
+	a.client.Close()
+
+	c.lock.Lock()
+	if c.clients[serverType][serverId] == a {
+		delete(c.clients[serverType], serverId)
+		c.version++
+	}
+	c.lock.Unlock()
+
+	// when the client was not connected
+	a.closeCalls()
+	a.notifyClose()
+	c.closeRemotes(serverType, serverId)
 }
 
 func DialServer(network, addr string, serverType uint16, serverId uint16) (*ClusterClientAgent, error) {
+	return Default.DialServer(network, addr, serverType, serverId)
+}
+
+func (c *Cluster) DialServer(network, addr string, serverType uint16, serverId uint16) (*ClusterClientAgent, error) {
 
 	agent := &ClusterClientAgent{
 		HallClientAgents: make(map[uint64]*HallClientAgent),
 		serverType:       serverType,
 		serverId:         serverId,
+		cluster:          c,
 		writeChan:        make(chan [][]byte, 250000),
 		stopChan:         make(chan int, 1)}
-	lock.Lock()
-	m, exist := clients[serverType]
+	c.lock.Lock()
+	m, exist := c.clients[serverType]
 	if !exist {
-		clients[serverType] = make(map[uint16]*ClusterClientAgent)
-		m = clients[serverType]
+		c.clients[serverType] = make(map[uint16]*ClusterClientAgent)
+		m = c.clients[serverType]
 	}
 
 	m[serverId] = agent
-	lock.Unlock()
+	c.version++
+	c.lock.Unlock()
 
 	client := new(ClusterTCPClient)
 	client.Addr = addr
@@ -69,38 +154,46 @@ func DialServer(network, addr string, serverType uint16, serverId uint16) (*Clus
 	client.PendingWriteNum = 250000
 	client.LenMsgLen = 2
 	client.MaxMsgLen = math.MaxUint32
-	client.FetchAgent = FetchAgent
+	client.FetchAgent = c.FetchAgent
 	client.AutoReconnect = true
 	client.LittleEndian = true
 
 	client.serverType = serverType
 	client.serverId = serverId
+	agent.client = client
 
 	client.Start()
 
 	return agent, nil
 }
 
+// the server of the uid by consistent hashing, stable while the servers
+// of the type do not change
 func FindClusterClientAgent(serverType uint16, uid uint64) (*ClusterClientAgent, error) {
-	lock.Lock()
-	defer lock.Unlock()
-	m, exist := clients[serverType]
-	if !exist {
-		return nil, fmt.Errorf("not exist serverType %d", serverType)
-	}
+	return Default.FindClusterClientAgent(serverType, uid)
+}
 
-	a, exist := m[0]
+func (c *Cluster) FindClusterClientAgent(serverType uint16, uid uint64) (*ClusterClientAgent, error) {
+	c.lock.Lock()
+	m, exist := c.hashModes[serverType]
 	if !exist {
-		return nil, fmt.Errorf("not exist serverType %d, serverId %d", serverType, 0)
+		m = NewConsistentHashSelectMode(serverType, 0, 0).(*ConsistentHashSelectMode)
+		m.Cluster = c
+		c.hashModes[serverType] = m
 	}
+	c.lock.Unlock()
 
-	return a, nil
+	return m.SelectUid(uid)
 }
 
 func FindClusterClientAgentStrict(serverType uint16, serverId uint16) (*ClusterClientAgent, error) {
-	lock.Lock()
-	defer lock.Unlock()
-	m, exist := clients[serverType]
+	return Default.FindClusterClientAgentStrict(serverType, serverId)
+}
+
+func (c *Cluster) FindClusterClientAgentStrict(serverType uint16, serverId uint16) (*ClusterClientAgent, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	m, exist := c.clients[serverType]
 	if !exist || m == nil {
 		return nil, fmt.Errorf("not exist serverType %d", serverType)
 	}
@@ -113,9 +206,13 @@ func FindClusterClientAgentStrict(serverType uint16, serverId uint16) (*ClusterC
 }
 
 func FindClusterClientAgentRandom(serverType uint16) (*ClusterClientAgent, error) {
-	lock.Lock()
-	defer lock.Unlock()
-	m, exist := clients[serverType]
+	return Default.FindClusterClientAgentRandom(serverType)
+}
+
+func (c *Cluster) FindClusterClientAgentRandom(serverType uint16) (*ClusterClientAgent, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	m, exist := c.clients[serverType]
 	if !exist {
 		return nil, fmt.Errorf("not exist serverType %d random", serverType)
 	}
@@ -137,12 +234,24 @@ func FindClusterClientAgentRandom(serverType uint16) (*ClusterClientAgent, error
 }
 
 func SendToGames(uid uint64, data []byte, except_serverType uint16) {
-	for serverType, agent := range clients {
+	Default.SendToGames(uid, data, except_serverType)
+}
+
+func (c *Cluster) SendToGames(uid uint64, data []byte, except_serverType uint16) {
+	// servers are dialed and removed meanwhile
+	c.lock.RLock()
+	var agents []*ClusterClientAgent
+	for serverType, agent := range c.clients {
 		if serverType == except_serverType {
 			continue
 		}
 		for _, gameAgent := range agent {
-			gameAgent.Forward(uid, data)
+			agents = append(agents, gameAgent)
 		}
 	}
+	c.lock.RUnlock()
+
+	for _, gameAgent := range agents {
+		gameAgent.Forward(uid, data)
+	}
 }
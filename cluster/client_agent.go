@@ -36,7 +36,7 @@ func (ca *ClientAgent) Start() {
 			select {
 			case message := <-ca.In:
 				// TODO need optimization
-				ca.lastAccessTime = time.Now()
+				ca.lastAccessTime = ca.cg.Clock.Now()
 				ca.HandleMsg(message)
 			case <-ca.exitSig:
 				ca.Destroy()
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net"
 	"sync"
+	"sync/atomic"
 
 	"github.com/qumi/matrix/log"
 	"github.com/qumi/matrix/network"
@@ -18,6 +19,10 @@ type ClusterClientAgent struct {
 	stopChan  chan int
 
 	c *ClusterTCPClient
+	// the client dialing the server, set before connecting
+	client  *ClusterTCPClient
+	cluster *Cluster
+	removed int32
 
 	userData interface{}
 
@@ -26,6 +31,11 @@ type ClusterClientAgent struct {
 
 	serverType uint16
 	serverId   uint16
+
+	// remote chanrpc calls
+	rpcLock    sync.Mutex
+	rpcSeq     uint64
+	rpcPending map[uint64]*rpcCall
 }
 
 func (a *ClusterClientAgent) GetServerId() uint16 {
@@ -42,6 +52,9 @@ func (a *ClusterClientAgent) Forward(uid uint64, bytes []byte) error {
 	if a.c == nil {
 		return errors.New("ClusterClientAgent Forward nil cluster tcp client")
 	}
+	if a.Removed() {
+		return errors.New("ClusterClientAgent Forward removed server")
+	}
 	if a.c.LittleEndian {
 		binary.LittleEndian.PutUint64(u, uid)
 	} else {
@@ -93,6 +106,11 @@ func (a *ClusterClientAgent) Run() {
 			uid = binary.BigEndian.Uint64(data)
 		}
 
+		if uid == rpcUid {
+			a.onResponse(data[uidLength:])
+			continue
+		}
+
 		a.l.RLock()
 		hca, exist := a.HallClientAgents[uid]
 		a.l.RUnlock()
@@ -106,9 +124,30 @@ func (a *ClusterClientAgent) Run() {
 
 func (a *ClusterClientAgent) OnClose() {
 	log.Error("ClusterClientAgent serverType:%v serverId:%v OnClose",a.serverType,a.serverId)
-	for _,agent := range a.HallClientAgents{
-		agent.Gate.OnClusterClientAgentClose(agent.Uid,a.serverType,a.serverId)
+	a.closeCalls()
+	a.cluster.closeRemotes(a.serverType, a.serverId)
+	a.notifyClose()
+}
+
+// the HallClientAgents of a removed server are notified once
+func (a *ClusterClientAgent) notifyClose() {
+	a.l.Lock()
+	agents := a.HallClientAgents
+	if a.Removed() {
+		a.HallClientAgents = make(map[uint64]*HallClientAgent)
 	}
+	a.l.Unlock()
+
+	for _, agent := range agents {
+		if agent.Gate.OnClusterClientAgentClose != nil {
+			agent.Gate.OnClusterClientAgentClose(agent.Uid, a.serverType, a.serverId)
+		}
+	}
+}
+
+// by RemoveServer
+func (a *ClusterClientAgent) Removed() bool {
+	return atomic.LoadInt32(&a.removed) == 1
 }
 
 func (a *ClusterClientAgent) WriteMsg(msg interface{}) {
@@ -5,6 +5,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/qumi/matrix/clock"
+	"github.com/qumi/matrix/conf"
+	"github.com/qumi/matrix/go"
 	"github.com/qumi/matrix/network"
 
 	"github.com/qumi/matrix/log"
@@ -27,7 +30,16 @@ type ClusterGate struct {
 	In     chan DisMsg
 
 	Manager *AgentManager
-	ticker  *time.Ticker
+	ticker  clock.Ticker
+
+	// of the client agent retention, the real clock when nil
+	Clock clock.Clock
+
+	// runs the remote chanrpc calls served, of conf.RemoteCallConcurrency
+	// goroutines closed with the gate when nil
+	CallPool *g.Pool
+	// of the servers exported, cluster.Default when nil
+	Cluster *Cluster
 }
 
 type DisMsg struct {
@@ -44,6 +56,10 @@ type HallMsg struct {
 func (cg *ClusterGate) Run(closeSig chan bool) {
 	cg.agents = make(map[uint64]*ClientAgent)
 	cg.In = make(chan DisMsg, 2000)
+	if cg.CallPool == nil {
+		cg.CallPool = g.NewPool(conf.RemoteCallConcurrency, remoteCallLen, g.Reject)
+		defer cg.CallPool.Close()
+	}
 
 	var tcpServer *network.TCPServer
 	if cg.TCPAddr != "" {
@@ -73,14 +89,14 @@ func (cg *ClusterGate) Run(closeSig chan bool) {
 }
 
 func (cg *ClusterGate) checkUnActiveClientAgent() {
-	cg.ticker = time.NewTicker(time.Minute)
+	cg.ticker = cg.Clock.NewTicker(time.Minute)
 	go func() {
-		for t := range cg.ticker.C {
+		for t := range cg.ticker.C() {
 			_ = t
 			cg.l.Lock()
 			log.Debug("cg agents size %d", len(cg.agents))
 			for uid, agent := range cg.agents {
-				if time.Now().Sub(agent.lastAccessTime) > retainTime {
+				if cg.Clock.Now().Sub(agent.lastAccessTime) > retainTime {
 					cg.DeleteClientAgent(uid)
 				}
 			}
@@ -92,6 +108,9 @@ func (cg *ClusterGate) checkUnActiveClientAgent() {
 }
 
 func (cg *ClusterGate) Start() {
+	if cg.Clock == nil {
+		cg.Clock = clock.Real
+	}
 	cg.checkUnActiveClientAgent()
 	go func() {
 		for {
@@ -60,6 +60,11 @@ func (a *ClusterServerAgent) Run() {
 		}
 		uid, d := a.cg.GetUIDData(data)
 
+		if uid == rpcUid {
+			a.goCall(d)
+			continue
+		}
+
 		if a.cg.Processor != nil {
 			msg, err := a.cg.Processor.Unmarshal(d)
 			if err != nil {
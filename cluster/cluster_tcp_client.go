@@ -117,7 +117,10 @@ reconnect:
 	client.Unlock()
 	agent.OnClose()
 
-	if client.AutoReconnect {
+	client.Lock()
+	closeFlag := client.closeFlag
+	client.Unlock()
+	if client.AutoReconnect && !closeFlag {
 		time.Sleep(client.ConnectInterval)
 		goto reconnect
 	}
@@ -19,6 +19,9 @@ type HallClientAgent struct {
 	conn network.Conn
 	Gate *HallGate
 
+	processor network.Processor
+	protocol  *network.Handshake
+
 	userData interface{}
 
 	State interface{}
@@ -30,7 +33,46 @@ type HallClientAgent struct {
 	*Selector
 }
 
+func (a *HallClientAgent) handshake() bool {
+	timeout := a.Gate.HandshakeTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	a.conn.SetReadDeadline(time.Now().Add(timeout))
+	data, err := a.conn.ReadMsg()
+	if err != nil {
+		log.Debug("HallClientAgent read handshake: %v", err)
+		return false
+	}
+
+	h, err := network.ParseHandshake(data, a.Gate.LittleEndian)
+	if err != nil {
+		log.Debug("HallClientAgent parse handshake error: %v", err)
+		return false
+	}
+	p, err := a.Gate.Processors.Select(h)
+	if err != nil {
+		log.Debug("HallClientAgent handshake error: %v", err)
+		return false
+	}
+
+	err = a.conn.WriteMsg(h.Marshal(a.Gate.LittleEndian))
+	if err != nil {
+		log.Debug("HallClientAgent write handshake error: %v", err)
+		return false
+	}
+
+	a.conn.SetReadDeadline(time.Time{})
+	a.processor = p
+	a.protocol = h
+	return true
+}
+
 func (a *HallClientAgent) Run() {
+	if a.Gate.Processors != nil && !a.handshake() {
+		return
+	}
+
 	for {
 		// msg_len|msg_type|id|data
 
@@ -53,13 +95,16 @@ func (a *HallClientAgent) Run() {
 
 		// msg processed in hall
 		if t == 0 {
-			if a.Gate.Processor != nil {
-				msg, err := a.Gate.Processor.Unmarshal(data[typeLength:])
+			if a.processor != nil {
+				msg, err := a.processor.Unmarshal(data[typeLength:])
 				if err != nil {
 					log.Error("unmarshal message error: %v", err)
-					break
+					if network.Disconnect(err) {
+						break
+					}
+					continue
 				}
-				err = a.Gate.Processor.Route(msg, a)
+				err = a.processor.Route(msg, a)
 				if err != nil {
 					log.Error("route message error: %v", err)
 					break
@@ -73,13 +118,17 @@ func (a *HallClientAgent) Run() {
 			}
 
 			ra, exist := a.remoteAgents[t]
+			if exist && ra.Removed() {
+				delete(a.remoteAgents, t)
+				exist = false
+			}
 			if exist {
 				e := ra.Forward(a.Uid, data[typeLength:])
 				if e != nil {
 					log.Error("forward return :" + e.Error())
 				}
 			} else {
-				remoteAgent, err := a.Select(t)
+				remoteAgent, err := a.SelectUid(t, a.Uid)
 				if err != nil {
 					//close ?
 					log.Error("a.Uid:%v route message error:%v", a.Uid, err)
@@ -107,8 +156,8 @@ func (a *HallClientAgent) OnClose() {
 }
 
 func (a *HallClientAgent) WriteMsg(msg interface{}) {
-	if a.Gate.Processor != nil {
-		data, err := a.Gate.Processor.Marshal(msg)
+	if a.processor != nil {
+		data, err := a.processor.Marshal(msg)
 		if err != nil {
 			log.Error("marshal message %v error: %v", reflect.TypeOf(msg), err)
 			return
@@ -121,8 +170,8 @@ func (a *HallClientAgent) WriteMsg(msg interface{}) {
 }
 
 func (a *HallClientAgent) WriteMsgWithType(msgType uint16, msg interface{}) {
-	if a.Gate.Processor != nil {
-		data, err := a.Gate.Processor.Marshal(msg)
+	if a.processor != nil {
+		data, err := a.processor.Marshal(msg)
 		if err != nil {
 			log.Error("marshal message %v error: %v", reflect.TypeOf(msg), err)
 			return
@@ -204,6 +253,11 @@ func (a *HallClientAgent) Destroy() {
 	a.conn.Destroy()
 }
 
+// nil when the gate does not negotiate protocols
+func (a *HallClientAgent) Protocol() *network.Handshake {
+	return a.protocol
+}
+
 func (a *HallClientAgent) UserData() interface{} {
 	return a.userData
 }
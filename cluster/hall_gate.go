@@ -2,6 +2,7 @@ package cluster
 
 import (
 	"github.com/qumi/matrix/chanrpc"
+	"github.com/qumi/matrix/clock"
 	"github.com/qumi/matrix/log"
 	"github.com/qumi/matrix/network"
 	"time"
@@ -14,6 +15,13 @@ type HallGate struct {
 	Processor       network.Processor
 	AgentChanRPC    *chanrpc.Server
 
+	// when set, clients must send a handshake first and the processor
+	// is selected per connection, Processor is ignored
+	Processors *network.ProcessorSet
+	// the connection is closed when no handshake is received in time,
+	// 10 seconds when 0
+	HandshakeTimeout time.Duration
+
 	// tcp
 	TCPAddr      string
 	LenMsgLen    int
@@ -21,7 +29,7 @@ type HallGate struct {
 
 	Manager *AgentManager
 
-	ticker         *time.Ticker
+	ticker         clock.Ticker
 	TimeOutSeconds time.Duration
 	//
 	HeartbeatHandler  func(uid KEY, agent interface{})
@@ -34,24 +42,33 @@ type HallGate struct {
 	CustomHandler func(hg *HallGate)
 
 	OnClusterClientAgentClose func(uid KEY, serverType uint16, server_id uint16)
+
+	// of the heartbeat ticker, the real clock when nil
+	Clock clock.Clock
+	// of the servers selected by the agents, cluster.Default when nil
+	Cluster *Cluster
 }
 
 func (gate *HallGate) newHallClientAgent(conn *network.TCPConn) network.Agent {
 	a := &HallClientAgent{
 		conn:         conn,
 		Gate:         gate,
+		processor:    gate.Processor,
 		State:        CREATE,
 		remoteAgents: make(map[uint16]*ClusterClientAgent),
-		Selector:     NewSelector(),
+		Selector:     &Selector{Cluster: gate.Cluster, modes: make(map[uint16]SelectMode)},
 	}
 
 	return a
 }
 
 func (gate *HallGate) HeartbeatAgent() {
-	gate.ticker = time.NewTicker(gate.TickerTimeSeconds)
+	if gate.Clock == nil {
+		gate.Clock = clock.Real
+	}
+	gate.ticker = gate.Clock.NewTicker(gate.TickerTimeSeconds)
 	go func() {
-		for t := range gate.ticker.C {
+		for t := range gate.ticker.C() {
 			_ = t
 			log.Debug("gate.Manager size %d", gate.Manager.Len())
 			for uid, agent := range gate.Manager.Clone() {
@@ -0,0 +1,115 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/qumi/matrix/discovery"
+	"github.com/qumi/matrix/log"
+)
+
+// the metadata of a server in discovery
+type ServerInfo struct {
+	Type uint16 `json:"type"`
+	Id   uint16 `json:"id"`
+	// dialed by the servers watching the base path
+	Addr string `json:"addr"`
+}
+
+type serverKey struct {
+	serverType uint16
+	serverId   uint16
+}
+
+func serverData(serverType uint16, serverId uint16) string {
+	return fmt.Sprintf("%d_%d", serverType, serverId)
+}
+
+// registers the local server under the base path
+func Register(d discovery.Discovery, basePath string, info ServerInfo) error {
+	metadata, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return d.Register(basePath, serverData(info.Type, info.Id), string(metadata))
+}
+
+func Unregister(d discovery.Discovery, basePath string, serverType uint16, serverId uint16) {
+	d.UnRegister(basePath, serverData(serverType, serverId))
+}
+
+// dials the servers appearing under the base path and removes the ones
+// disappearing, of the server types only when given. servers dialed by
+// DialServer are left alone
+//
+// blocks as the Watch of d
+func Watch(d discovery.Discovery, basePath string, serverTypes ...uint16) {
+	Default.Watch(d, basePath, serverTypes...)
+}
+
+func (c *Cluster) Watch(d discovery.Discovery, basePath string, serverTypes ...uint16) {
+	w := newWatcher(c, serverTypes)
+	d.Watch(basePath, w.sync)
+}
+
+type watcher struct {
+	cluster     *Cluster
+	serverTypes map[uint16]bool
+	// dialed by the watcher, key -> addr
+	servers map[serverKey]string
+}
+
+func newWatcher(c *Cluster, serverTypes []uint16) *watcher {
+	w := new(watcher)
+	w.cluster = c
+	w.servers = make(map[serverKey]string)
+	if len(serverTypes) > 0 {
+		w.serverTypes = make(map[uint16]bool)
+		for _, t := range serverTypes {
+			w.serverTypes[t] = true
+		}
+	}
+	return w
+}
+
+// pairs are all the servers under the base path
+func (w *watcher) sync(pairs []*discovery.DataPair) {
+	infos := make(map[serverKey]ServerInfo)
+	for _, p := range pairs {
+		var info ServerInfo
+		err := json.Unmarshal([]byte(p.Metadata), &info)
+		if err != nil {
+			log.Error("invalid server %v: %v", p.Data, err)
+			continue
+		}
+		if w.serverTypes != nil && !w.serverTypes[info.Type] {
+			continue
+		}
+		infos[serverKey{info.Type, info.Id}] = info
+	}
+
+	for key, addr := range w.servers {
+		if info, ok := infos[key]; ok && info.Addr == addr {
+			continue
+		}
+		log.Release("server type %v id %v at %v is gone", key.serverType, key.serverId, addr)
+		w.cluster.RemoveServer(key.serverType, key.serverId)
+		delete(w.servers, key)
+	}
+
+	for key, info := range infos {
+		if _, ok := w.servers[key]; ok {
+			continue
+		}
+		if _, err := w.cluster.FindClusterClientAgentStrict(key.serverType, key.serverId); err == nil {
+			continue
+		}
+		log.Release("server type %v id %v at %v is found", key.serverType, key.serverId, info.Addr)
+		_, err := w.cluster.DialServer("tcp", info.Addr, key.serverType, key.serverId)
+		if err != nil {
+			log.Error("dial server type %v id %v: %v", key.serverType, key.serverId, err)
+			continue
+		}
+		w.servers[key] = info.Addr
+	}
+}
@@ -0,0 +1,119 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/qumi/matrix/discovery"
+)
+
+type fakeDiscovery struct {
+	pairs   map[string]string
+	handler discovery.HandlerFunc
+}
+
+func (d *fakeDiscovery) Register(basePath string, data string, metadata string) error {
+	d.pairs[data] = metadata
+	d.notify()
+	return nil
+}
+
+func (d *fakeDiscovery) UnRegister(basePath string, data string) {
+	delete(d.pairs, data)
+	d.notify()
+}
+
+func (d *fakeDiscovery) Watch(basePath string, handler discovery.HandlerFunc) {
+	d.handler = handler
+	d.notify()
+}
+
+func (d *fakeDiscovery) notify() {
+	if d.handler == nil {
+		return
+	}
+	var pairs []*discovery.DataPair
+	for data, metadata := range d.pairs {
+		pairs = append(pairs, &discovery.DataPair{Data: data, Metadata: metadata})
+	}
+	d.handler(pairs)
+}
+
+func TestWatch(t *testing.T) {
+	const serverType, serverId = 7, 1
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	d := &fakeDiscovery{pairs: make(map[string]string)}
+	c := New()
+	defer c.Close()
+	c.Watch(d, "servers", serverType)
+
+	// other server types are not dialed
+	err = Register(d, "servers", ServerInfo{Type: serverType + 1, Id: serverId, Addr: ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.FindClusterClientAgentStrict(serverType+1, serverId); err == nil {
+		t.Fatal("server of another type dialed")
+	}
+
+	err = Register(d, "servers", ServerInfo{Type: serverType, Id: serverId, Addr: ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := c.FindClusterClientAgentStrict(serverType, serverId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case conn := <-accepted:
+		defer conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("server not dialed")
+	}
+
+	var closed []uint64
+	gate := &HallGate{OnClusterClientAgentClose: func(uid KEY, serverType uint16, serverId uint16) {
+		closed = append(closed, uid.(uint64))
+	}}
+	hca := &HallClientAgent{Gate: gate, Uid: 42, remoteAgents: make(map[uint16]*ClusterClientAgent)}
+	hca.SetNewRemoteAgent(a, serverType)
+
+	Unregister(d, "servers", serverType, serverId)
+	if _, err := c.FindClusterClientAgentStrict(serverType, serverId); err == nil {
+		t.Fatal("server not removed")
+	}
+	if len(closed) != 1 || closed[0] != 42 {
+		t.Fatalf("closed %v, want [42]", closed)
+	}
+	if !a.Removed() || a.Forward(42, nil) == nil {
+		t.Fatal("removed server forwarding")
+	}
+}
+
+func TestServerInfo(t *testing.T) {
+	data, err := json.Marshal(ServerInfo{Type: 2, Id: 3, Addr: "127.0.0.1:3563"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"type":2,"id":3,"addr":"127.0.0.1:3563"}` {
+		t.Fatal(string(data))
+	}
+}
@@ -0,0 +1,233 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/qumi/matrix/chanrpc"
+	"github.com/qumi/matrix/conf"
+	"github.com/qumi/matrix/log"
+)
+
+// remote chanrpc calls are carried on cluster links with uid 0,
+// arguments and results are json encoded, so functions called remotely
+// get json decoded values (float64, string, []interface{}, map...)
+const rpcUid = 0
+
+const remoteCallLen = 1000
+
+type rpcRequest struct {
+	Seq    uint64
+	Server string
+	ID     string
+	Args   []interface{}
+}
+
+type rpcResponse struct {
+	Seq uint64
+	Ret interface{}
+	Err string
+}
+
+type rpcCall struct {
+	cb func(interface{}, error)
+	t  *time.Timer
+}
+
+type remoteKey struct {
+	serverType uint16
+	serverId   uint16
+	name       string
+}
+
+// use in game, makes the functions of s callable from hall by name
+func Export(name string, s *chanrpc.Server) {
+	Default.Export(name, s)
+}
+
+func (c *Cluster) Export(name string, s *chanrpc.Server) {
+	c.exportLock.Lock()
+	defer c.exportLock.Unlock()
+	c.exports[name] = s
+}
+
+func Unexport(name string) {
+	Default.Unexport(name)
+}
+
+func (c *Cluster) Unexport(name string) {
+	c.exportLock.Lock()
+	defer c.exportLock.Unlock()
+	delete(c.exports, name)
+}
+
+func (c *Cluster) exported(name string) *chanrpc.Server {
+	c.exportLock.RLock()
+	defer c.exportLock.RUnlock()
+	return c.exports[name]
+}
+
+// use in hall, a local proxy of the server exported by name on the game
+// server, e.g. skeleton.AsynCall(cluster.RemoteServer(t, id, "game"), "f", args..., cb)
+func RemoteServer(serverType uint16, serverId uint16, name string) *chanrpc.Server {
+	return Default.RemoteServer(serverType, serverId, name)
+}
+
+func (c *Cluster) RemoteServer(serverType uint16, serverId uint16, name string) *chanrpc.Server {
+	c.remoteLock.Lock()
+	defer c.remoteLock.Unlock()
+
+	k := remoteKey{serverType: serverType, serverId: serverId, name: name}
+	if s, ok := c.remotes[k]; ok {
+		return s
+	}
+
+	s := chanrpc.NewRemoteServer(remoteCallLen, func(id interface{}, args []interface{}, cb func(interface{}, error)) {
+		a, err := c.FindClusterClientAgentStrict(serverType, serverId)
+		if err != nil {
+			cb(nil, err)
+			return
+		}
+		a.call(name, id, args, cb)
+	})
+	c.remotes[k] = s
+	return s
+}
+
+// the proxies of a server are closed with its link, calls queued fail and
+// RemoteServer makes new proxies
+func (c *Cluster) closeRemotes(serverType uint16, serverId uint16) {
+	c.remoteLock.Lock()
+	var closed []*chanrpc.Server
+	for k, s := range c.remotes {
+		if k.serverType == serverType && k.serverId == serverId {
+			closed = append(closed, s)
+			delete(c.remotes, k)
+		}
+	}
+	c.remoteLock.Unlock()
+
+	for _, s := range closed {
+		s.Close()
+	}
+}
+
+func (a *ClusterClientAgent) call(server string, id interface{}, args []interface{}, cb func(interface{}, error)) {
+	sid, ok := id.(string)
+	if !ok {
+		cb(nil, fmt.Errorf("function id %v: remote function id must be string", id))
+		return
+	}
+
+	a.rpcLock.Lock()
+	if a.rpcPending == nil {
+		a.rpcPending = make(map[uint64]*rpcCall)
+	}
+	a.rpcSeq++
+	seq := a.rpcSeq
+	a.rpcPending[seq] = &rpcCall{
+		cb: cb,
+		t: time.AfterFunc(conf.RemoteCallTimeout, func() {
+			a.done(seq, nil, chanrpc.ErrTimeout)
+		}),
+	}
+	a.rpcLock.Unlock()
+
+	data, err := json.Marshal(&rpcRequest{Seq: seq, Server: server, ID: sid, Args: args})
+	if err == nil {
+		err = a.Forward(rpcUid, data)
+	}
+	if err != nil {
+		a.done(seq, nil, err)
+	}
+}
+
+func (a *ClusterClientAgent) done(seq uint64, ret interface{}, err error) {
+	a.rpcLock.Lock()
+	c, ok := a.rpcPending[seq]
+	delete(a.rpcPending, seq)
+	a.rpcLock.Unlock()
+
+	if ok {
+		c.t.Stop()
+		c.cb(ret, err)
+	}
+}
+
+func (a *ClusterClientAgent) onResponse(data []byte) {
+	var resp rpcResponse
+	err := json.Unmarshal(data, &resp)
+	if err != nil {
+		log.Error("unmarshal chanrpc response error: %v", err)
+		return
+	}
+
+	if resp.Err != "" {
+		a.done(resp.Seq, nil, errors.New(resp.Err))
+	} else {
+		a.done(resp.Seq, resp.Ret, nil)
+	}
+}
+
+func (a *ClusterClientAgent) closeCalls() {
+	a.rpcLock.Lock()
+	pending := a.rpcPending
+	a.rpcPending = nil
+	a.rpcLock.Unlock()
+
+	for _, c := range pending {
+		c.t.Stop()
+		c.cb(nil, errors.New("cluster link closed"))
+	}
+}
+
+// calls are served on the call pool of the gate, the caller gets an error
+// when the pool is full
+func (a *ClusterServerAgent) goCall(data []byte) {
+	req := new(rpcRequest)
+	err := json.Unmarshal(data, req)
+	if err != nil {
+		log.Error("unmarshal chanrpc request error: %v", err)
+		return
+	}
+
+	err = a.cg.CallPool.Submit(func() {
+		a.serveCall(req)
+	})
+	if err != nil {
+		a.reply(&rpcResponse{Seq: req.Seq, Err: err.Error()})
+	}
+}
+
+func (a *ClusterServerAgent) serveCall(req *rpcRequest) {
+	resp := &rpcResponse{Seq: req.Seq}
+	if s := orDefault(a.cg.Cluster).exported(req.Server); s == nil {
+		resp.Err = fmt.Sprintf("chanrpc server %v not exported", req.Server)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), conf.RemoteCallTimeout)
+		ret, err := s.CallContext(ctx, req.ID, req.Args...)
+		cancel()
+		if err != nil {
+			resp.Err = err.Error()
+		} else {
+			resp.Ret = ret
+		}
+	}
+
+	a.reply(resp)
+}
+
+func (a *ClusterServerAgent) reply(resp *rpcResponse) {
+	b, err := json.Marshal(resp)
+	if err != nil {
+		b, _ = json.Marshal(&rpcResponse{Seq: resp.Seq, Err: err.Error()})
+	}
+
+	err = a.conn.WriteMsg(make([]byte, uidLength), b)
+	if err != nil {
+		log.Error("write chanrpc response error: %v", err)
+	}
+}
@@ -5,7 +5,9 @@ type SelectMode interface {
 }
 
 type Selector struct {
-	modes map[uint16]SelectMode
+	// of the server types without a mode, cluster.Default when nil
+	Cluster *Cluster
+	modes   map[uint16]SelectMode
 }
 
 func NewSelector() *Selector {
@@ -31,7 +33,27 @@ func (s *Selector) Set(serverType uint16, mode SelectMode) {
 func (s *Selector) Select(serverType uint16) (*ClusterClientAgent, error) {
 	mode := s.Get(serverType)
 	if mode == nil {
-		return FindClusterClientAgentRandom(serverType)
+		return orDefault(s.cluster()).FindClusterClientAgentRandom(serverType)
 	}
 	return mode.Select()
 }
+
+// by uid only when the mode of the server type is a UidSelectMode (e.g.
+// NewConsistentHashSelectMode), as Select otherwise
+func (s *Selector) SelectUid(serverType uint16, uid uint64) (*ClusterClientAgent, error) {
+	mode := s.Get(serverType)
+	if mode == nil {
+		return s.Select(serverType)
+	}
+	if m, ok := mode.(UidSelectMode); ok {
+		return m.SelectUid(uid)
+	}
+	return mode.Select()
+}
+
+func (s *Selector) cluster() *Cluster {
+	if s == nil {
+		return nil
+	}
+	return s.Cluster
+}
@@ -0,0 +1,145 @@
+package cluster
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync"
+)
+
+// a SelectMode selecting by uid
+type UidSelectMode interface {
+	SelectMode
+	SelectUid(uid uint64) (*ClusterClientAgent, error)
+}
+
+// maps uids to servers on a hash ring of virtual nodes, a server joining or
+// leaving moves the uids of its part of the ring only
+//
+// goroutine safe
+type ConsistentHashSelectMode struct {
+	ServerType uint16
+	Replicas   int
+	// bounded loads when positive, a server takes at most 1+LoadFactor
+	// times the average number of uids routed to the servers, the load is
+	// the number of HallClientAgents of the server
+	LoadFactor float64
+	// cluster.Default when nil
+	Cluster *Cluster
+
+	mutex   sync.Mutex
+	version uint64
+	ring    []hashNode
+	agents  []*ClusterClientAgent
+}
+
+type hashNode struct {
+	hash  uint64
+	agent *ClusterClientAgent
+}
+
+// 100 virtual nodes per server when replicas is not positive
+func NewConsistentHashSelectMode(serverType uint16, replicas int, loadFactor float64) SelectMode {
+	if replicas <= 0 {
+		replicas = 100
+	}
+
+	m := new(ConsistentHashSelectMode)
+	m.ServerType = serverType
+	m.Replicas = replicas
+	m.LoadFactor = loadFactor
+	return m
+}
+
+// random without a uid
+func (m *ConsistentHashSelectMode) Select() (*ClusterClientAgent, error) {
+	return orDefault(m.Cluster).FindClusterClientAgentRandom(m.ServerType)
+}
+
+func (m *ConsistentHashSelectMode) SelectUid(uid uint64) (*ClusterClientAgent, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.build()
+	if len(m.ring) == 0 {
+		return nil, fmt.Errorf("not exist serverType %d", m.ServerType)
+	}
+
+	u := make([]byte, uidLength)
+	binary.LittleEndian.PutUint64(u, uid)
+	h := hash64(u)
+	i := sort.Search(len(m.ring), func(i int) bool {
+		return m.ring[i].hash >= h
+	})
+	if i == len(m.ring) {
+		i = 0
+	}
+	if m.LoadFactor <= 0 {
+		return m.ring[i].agent, nil
+	}
+
+	loads := make(map[*ClusterClientAgent]int, len(m.agents))
+	total := 0
+	for _, a := range m.agents {
+		a.l.RLock()
+		_, routed := a.HallClientAgents[uid]
+		loads[a] = len(a.HallClientAgents)
+		a.l.RUnlock()
+		if routed {
+			return a, nil
+		}
+		total += loads[a]
+	}
+	capacity := int(math.Ceil(float64(total+1) / float64(len(m.agents)) * (1 + m.LoadFactor)))
+
+	// the next server on the ring below the capacity
+	for n := 0; n < len(m.ring); n++ {
+		a := m.ring[(i+n)%len(m.ring)].agent
+		if loads[a] < capacity {
+			return a, nil
+		}
+	}
+	return m.ring[i].agent, nil
+}
+
+// rebuilds the ring when servers are dialed or removed
+func (m *ConsistentHashSelectMode) build() {
+	c := orDefault(m.Cluster)
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if m.ring != nil && m.version == c.version {
+		return
+	}
+
+	m.version = c.version
+	m.ring = make([]hashNode, 0, len(c.clients[m.ServerType])*m.Replicas)
+	m.agents = make([]*ClusterClientAgent, 0, len(c.clients[m.ServerType]))
+	for serverId, a := range c.clients[m.ServerType] {
+		m.agents = append(m.agents, a)
+		for r := 0; r < m.Replicas; r++ {
+			h := hash64([]byte(fmt.Sprintf("%d-%d-%d", m.ServerType, serverId, r)))
+			m.ring = append(m.ring, hashNode{hash: h, agent: a})
+		}
+	}
+	sort.Slice(m.ring, func(i, j int) bool {
+		if m.ring[i].hash == m.ring[j].hash {
+			return m.ring[i].agent.serverId < m.ring[j].agent.serverId
+		}
+		return m.ring[i].hash < m.ring[j].hash
+	})
+}
+
+// fnv mixed by the murmur3 finalizer, fnv alone clusters similar keys
+func hash64(data []byte) uint64 {
+	f := fnv.New64a()
+	f.Write(data)
+	h := f.Sum64()
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,157 @@
+package cluster
+
+import (
+	"testing"
+)
+
+func addServers(c *Cluster, serverType uint16, serverIds ...uint16) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.clients[serverType] == nil {
+		c.clients[serverType] = make(map[uint16]*ClusterClientAgent)
+	}
+	for _, id := range serverIds {
+		c.clients[serverType][id] = &ClusterClientAgent{
+			HallClientAgents: make(map[uint64]*HallClientAgent),
+			serverType:       serverType,
+			serverId:         id,
+		}
+	}
+	c.version++
+}
+
+func removeServers(c *Cluster, serverType uint16, serverIds ...uint16) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, id := range serverIds {
+		delete(c.clients[serverType], id)
+	}
+	c.version++
+}
+
+func route(t *testing.T, m UidSelectMode, uids int) map[uint64]uint16 {
+	routes := make(map[uint64]uint16)
+	for uid := uint64(1); uid <= uint64(uids); uid++ {
+		a, err := m.SelectUid(uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		routes[uid] = a.serverId
+	}
+	return routes
+}
+
+func TestConsistentHash(t *testing.T) {
+	const serverType = 101
+	const uids = 10000
+	c := New()
+	addServers(c, serverType, 1, 2, 3, 4)
+
+	hm := NewConsistentHashSelectMode(serverType, 0, 0).(*ConsistentHashSelectMode)
+	hm.Cluster = c
+	m := UidSelectMode(hm)
+	before := route(t, m, uids)
+	if again := route(t, m, uids); len(again) != len(before) {
+		t.Fatal("routes changed")
+	} else {
+		for uid, id := range again {
+			if before[uid] != id {
+				t.Fatalf("uid %v moved from %v to %v", uid, before[uid], id)
+			}
+		}
+	}
+
+	counts := make(map[uint16]int)
+	for _, id := range before {
+		counts[id]++
+	}
+	for id := uint16(1); id <= 4; id++ {
+		if counts[id] < uids/4/2 {
+			t.Fatalf("server %v takes %v of %v uids", id, counts[id], uids)
+		}
+	}
+
+	// only the uids of the server joining move
+	addServers(c, serverType, 5)
+	after := route(t, m, uids)
+	for uid, id := range after {
+		if before[uid] != id && id != 5 {
+			t.Fatalf("uid %v moved from %v to %v", uid, before[uid], id)
+		}
+	}
+
+	// only the uids of the server leaving move
+	removeServers(c, serverType, 2)
+	for uid, id := range route(t, m, uids) {
+		if after[uid] != id && after[uid] != 2 {
+			t.Fatalf("uid %v moved from %v to %v", uid, after[uid], id)
+		}
+	}
+
+	a, err := c.FindClusterClientAgent(serverType, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := m.SelectUid(42); a != b {
+		t.Fatalf("FindClusterClientAgent: server %v, want %v", a.serverId, b.serverId)
+	}
+}
+
+func TestConsistentHashBoundedLoad(t *testing.T) {
+	const serverType = 102
+	const uids = 1000
+	c := New()
+	addServers(c, serverType, 1, 2, 3)
+
+	m := &ConsistentHashSelectMode{ServerType: serverType, Replicas: 100, LoadFactor: 0.25, Cluster: c}
+	for uid := uint64(1); uid <= uids; uid++ {
+		a, err := m.SelectUid(uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.HallClientAgents[uid] = &HallClientAgent{Uid: uid}
+
+		// routed uids stay
+		if b, _ := m.SelectUid(uid); b != a {
+			t.Fatalf("uid %v moved", uid)
+		}
+	}
+
+	max := uids * 125 / 100 / 3
+	for id, a := range c.clients[serverType] {
+		if len(a.HallClientAgents) > max+1 {
+			t.Fatalf("server %v takes %v of %v uids", id, len(a.HallClientAgents), uids)
+		}
+	}
+}
+
+func TestSelectUidOptIn(t *testing.T) {
+	const serverType = 103
+	c := New()
+	addServers(c, serverType, 1, 2, 3, 4)
+
+	// random without a mode
+	s := NewSelector()
+	s.Cluster = c
+	servers := make(map[uint16]bool)
+	for i := 0; i < 200; i++ {
+		a, err := s.SelectUid(serverType, 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		servers[a.serverId] = true
+	}
+	if len(servers) < 2 {
+		t.Fatal("uid hashed without a hash mode")
+	}
+
+	hm := NewConsistentHashSelectMode(serverType, 0, 0).(*ConsistentHashSelectMode)
+	hm.Cluster = c
+	s.Set(serverType, hm)
+	want, _ := hm.SelectUid(42)
+	for i := 0; i < 200; i++ {
+		if a, _ := s.SelectUid(serverType, 42); a != want {
+			t.Fatalf("uid 42 on server %v, want %v", a.serverId, want.serverId)
+		}
+	}
+}
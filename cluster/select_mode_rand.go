@@ -2,10 +2,12 @@ package cluster
 
 type RandomSelectMode struct {
 	ServerType uint16
+	// cluster.Default when nil
+	Cluster *Cluster
 }
 
 func (m *RandomSelectMode) Select() (*ClusterClientAgent, error) {
-	return FindClusterClientAgentRandom(m.ServerType)
+	return orDefault(m.Cluster).FindClusterClientAgentRandom(m.ServerType)
 }
 
 func NewRandomSelectMode(serverType uint16) SelectMode {
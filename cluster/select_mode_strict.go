@@ -7,11 +7,13 @@ import (
 type StrictSelectMode struct {
 	ServerType uint16
 	ServerIds  map[uint16]bool
+	// cluster.Default when nil
+	Cluster *Cluster
 }
 
 func (m *StrictSelectMode) Select() (*ClusterClientAgent, error) {
 	for id := range m.ServerIds {
-		return FindClusterClientAgentStrict(m.ServerType, id)
+		return orDefault(m.Cluster).FindClusterClientAgentStrict(m.ServerType, id)
 	}
 	return nil, fmt.Errorf("StrictSelectMode: empty ServerIds")
 }
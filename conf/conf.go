@@ -1,5 +1,7 @@
 package conf
 
+import "time"
+
 var (
 	LenStackBuf = 4096
 
@@ -8,13 +10,35 @@ var (
 	LogPath  string
 	LogFlag  int
 
+	// matrix.Run gives up the shutdown after the timeout, 0 waits forever
+	ShutdownTimeout time.Duration
+
 	// console
 	ConsolePort   int
 	ConsolePrompt string = "matrix# "
 	ProfilePath   string
+	// external commands not returning in time fail with a timeout
+	ConsoleCallTimeout = 10 * time.Second
+
+	// chanrpc calls executing longer are logged, 0 disables the logging
+	SlowCallThreshold time.Duration
+	// default of chanrpc.Server.SetDetectDeadlock, synchronous call cycles
+	// fail instead of hanging forever at the cost of goroutine id lookups
+	DetectDeadlock bool
+
+	// watchdog, skeleton handlers running longer are reported stuck,
+	// 0 disables the watchdog
+	WatchdogThreshold = 5 * time.Second
+	WatchdogInterval  = time.Second
+	// health check endpoint, e.g. "localhost:8080" serving /health
+	HealthAddr string
 
 	// cluster
 	ListenAddr      string
 	ConnAddrs       []string
 	PendingWriteNum int
+	// remote chanrpc calls not returning in time fail with a timeout
+	RemoteCallTimeout = 10 * time.Second
+	// remote chanrpc calls served at a time by a cluster gate
+	RemoteCallConcurrency = 64
 )
@@ -1,6 +1,7 @@
 package console
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/qumi/matrix/chanrpc"
@@ -17,6 +18,7 @@ var commands = []Command{
 	new(CommandHelp),
 	new(CommandCPUProf),
 	new(CommandProf),
+	new(CommandChanRPC),
 }
 
 type Command interface {
@@ -48,7 +50,14 @@ func (c *ExternalCommand) run(_args []string) string {
 		args[i] = v
 	}
 
-	ret, err := c.server.Call1(c._name, args...)
+	ctx := context.Background()
+	if conf.ConsoleCallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.ConsoleCallTimeout)
+		defer cancel()
+	}
+
+	ret, err := c.server.Call1Context(ctx, c._name, args...)
 	if err != nil {
 		return err.Error()
 	}
@@ -60,26 +69,83 @@ func (c *ExternalCommand) run(_args []string) string {
 	return output
 }
 
-// you must call the function before calling console.Init
-// goroutine not safe
-func Register(name string, help string, f interface{}, server *chanrpc.Server) {
-	for _, c := range commands {
+func registered(name string, cmds []Command) {
+	for _, c := range cmds {
 		if c.name() == name {
 			log.Fatal("command %v is already registered", name)
 		}
 	}
+}
 
+func newExternalCommand(name string, help string, f interface{}, server *chanrpc.Server) Command {
 	server.Register(name, f)
 
 	c := new(ExternalCommand)
 	c._name = name
 	c._help = help
 	c.server = server
-	commands = append(commands, c)
+	return c
+}
+
+// the command is served by all consoles
+//
+// you must call the function before calling console.Init
+// goroutine not safe
+func Register(name string, help string, f interface{}, server *chanrpc.Server) {
+	registered(name, commands)
+	commands = append(commands, newExternalCommand(name, help, f, server))
+}
+
+// the command is served by c only
+//
+// you must call the function before calling c.Start
+// goroutine not safe
+func (c *Console) Register(name string, help string, f interface{}, server *chanrpc.Server) {
+	registered(name, c.all())
+	c.commands = append(c.commands, newExternalCommand(name, help, f, server))
+}
+
+type FuncCommand struct {
+	_name string
+	_help string
+	f     func(args []string) string
+}
+
+func (c *FuncCommand) name() string {
+	return c._name
+}
+
+func (c *FuncCommand) help() string {
+	return c._help
+}
+
+func (c *FuncCommand) run(args []string) string {
+	return c.f(args)
+}
+
+// f is called on the console goroutine, so it must be goroutine safe
+//
+// you must call the function before calling console.Init
+// goroutine not safe
+func RegisterFunc(name string, help string, f func(args []string) string) {
+	registered(name, commands)
+	commands = append(commands, &FuncCommand{_name: name, _help: help, f: f})
+}
+
+// the command is served by c only
+//
+// you must call the function before calling c.Start
+// goroutine not safe
+func (c *Console) RegisterFunc(name string, help string, f func(args []string) string) {
+	registered(name, c.all())
+	c.commands = append(c.commands, &FuncCommand{_name: name, _help: help, f: f})
 }
 
 // help
-type CommandHelp struct{}
+type CommandHelp struct {
+	// lists the commands of the console, the shared commands when nil
+	console *Console
+}
 
 func (c *CommandHelp) name() string {
 	return "help"
@@ -91,7 +157,7 @@ func (c *CommandHelp) help() string {
 
 func (c *CommandHelp) run([]string) string {
 	output := "Commands:\r\n"
-	for _, c := range commands {
+	for _, c := range c.console.all() {
 		output += c.name() + " - " + c.help() + "\r\n"
 	}
 	output += "quit - exit console"
@@ -215,3 +281,56 @@ func (c *CommandProf) run(args []string) string {
 
 	return fn
 }
+
+// chanrpc
+type CommandChanRPC struct{}
+
+func (c *CommandChanRPC) name() string {
+	return "chanrpc"
+}
+
+func (c *CommandChanRPC) help() string {
+	return "chanrpc server stats"
+}
+
+func (c *CommandChanRPC) usage() string {
+	return "chanrpc shows the stats of monitored chanrpc servers\r\n\r\n" +
+		"Usage: chanrpc [name]\r\n" +
+		"  name - execution time per function id of the server"
+}
+
+func (c *CommandChanRPC) run(args []string) string {
+	stats := chanrpc.MonitoredStats()
+
+	if len(args) == 0 {
+		output := fmt.Sprintf("%-16v %10v %8v %12v %10v %8v %8v",
+			"Name", "Queue", "Pending", "Calls", "Calls/s", "Panics", "Canceled")
+		for _, st := range stats {
+			output += fmt.Sprintf("\r\n%-16v %10v %8v %12v %10.1f %8v %8v",
+				st.Name,
+				fmt.Sprintf("%v/%v", st.QueueLen, st.QueueCap),
+				st.PendingAsynCall,
+				st.Calls,
+				st.CallsPerSec,
+				st.Panics,
+				st.Canceled)
+		}
+		return output
+	}
+
+	for _, st := range stats {
+		if st.Name != args[0] {
+			continue
+		}
+
+		output := fmt.Sprintf("%-24v %12v %8v %12v %12v %12v",
+			"Function", "Calls", "Panics", "P50", "P99", "Max")
+		for _, f := range st.Funcs {
+			output += fmt.Sprintf("\r\n%-24v %12v %8v %12v %12v %12v",
+				f.ID, f.Calls, f.Panics, f.P50, f.P99, f.Max)
+		}
+		return output
+	}
+
+	return c.usage()
+}
@@ -9,44 +9,91 @@ import (
 	"strings"
 )
 
-var server *network.TCPServer
+// a console server, serves the commands registered on it and the commands
+// shared by the consoles
+type Console struct {
+	Addr     string
+	Prompt   string
+	server   *network.TCPServer
+	commands []Command
+}
+
+var console *Console
 
 func Init() {
 	if conf.ConsolePort == 0 {
 		return
 	}
 
-	server = new(network.TCPServer)
-	server.Addr = "localhost:" + strconv.Itoa(conf.ConsolePort)
-	server.MaxConnNum = int(math.MaxInt32)
-	server.PendingWriteNum = 100
-	server.NewAgent = newAgent
-
-	server.Start()
+	console = &Console{
+		Addr:   "localhost:" + strconv.Itoa(conf.ConsolePort),
+		Prompt: conf.ConsolePrompt,
+	}
+	console.Start()
 }
 
 func Destroy() {
-	if server != nil {
-		server.Close()
+	if console != nil {
+		console.Close()
+	}
+}
+
+func (c *Console) Start() {
+	c.server = new(network.TCPServer)
+	c.server.Addr = c.Addr
+	c.server.MaxConnNum = int(math.MaxInt32)
+	c.server.PendingWriteNum = 100
+	c.server.NewAgent = c.newAgent
+
+	c.server.Start()
+}
+
+func (c *Console) Close() {
+	if c.server != nil {
+		c.server.Close()
+		c.server = nil
 	}
 }
 
+func (c *Console) lookup(name string) Command {
+	if name == "help" {
+		return &CommandHelp{console: c}
+	}
+	for _, cmd := range c.all() {
+		if cmd.name() == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// the shared commands first
+func (c *Console) all() []Command {
+	all := append([]Command(nil), commands...)
+	if c != nil {
+		all = append(all, c.commands...)
+	}
+	return all
+}
+
 type Agent struct {
-	conn   *network.TCPConn
-	reader *bufio.Reader
+	conn    *network.TCPConn
+	reader  *bufio.Reader
+	console *Console
 }
 
-func newAgent(conn *network.TCPConn) network.Agent {
+func (c *Console) newAgent(conn *network.TCPConn) network.Agent {
 	a := new(Agent)
 	a.conn = conn
 	a.reader = bufio.NewReader(conn)
+	a.console = c
 	return a
 }
 
 func (a *Agent) Run() {
 	for {
-		if conf.ConsolePrompt != "" {
-			a.conn.Write([]byte(conf.ConsolePrompt))
+		if a.console.Prompt != "" {
+			a.conn.Write([]byte(a.console.Prompt))
 		}
 
 		line, err := a.reader.ReadString('\n')
@@ -62,13 +109,7 @@ func (a *Agent) Run() {
 		if args[0] == "quit" {
 			break
 		}
-		var c Command
-		for _, _c := range commands {
-			if _c.name() == args[0] {
-				c = _c
-				break
-			}
-		}
+		c := a.console.lookup(args[0])
 		if c == nil {
 			a.conn.Write([]byte("command not found, try `help` for help\r\n"))
 			continue
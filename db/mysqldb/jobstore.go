@@ -0,0 +1,69 @@
+package mysqldb
+
+import (
+	"time"
+
+	"github.com/qumi/matrix/schedule"
+)
+
+//JobStore is a schedule.Store keeping jobs in a table
+type JobStore struct {
+	db    *MysqlDB
+	table string
+}
+
+//NewJobStore create the table if not exists
+func NewJobStore(db *MysqlDB, table string) (*JobStore, error) {
+	_, err := db.Exec("CREATE TABLE IF NOT EXISTS `" + table + "` (" +
+		"`id` VARCHAR(128) NOT NULL," +
+		"`name` VARCHAR(64) NOT NULL," +
+		"`data` BLOB NOT NULL," +
+		"`at` BIGINT NOT NULL," +
+		"`cron` VARCHAR(255) NOT NULL DEFAULT ''," +
+		"`catchup` INT NOT NULL DEFAULT 0," +
+		"PRIMARY KEY (`id`))")
+	if err != nil {
+		return nil, err
+	}
+	return &JobStore{db: db, table: table}, nil
+}
+
+//Save insert or replace the job, at is in unix nanoseconds
+func (s *JobStore) Save(job *schedule.Job) error {
+	_, err := s.db.Exec("REPLACE INTO `"+s.table+"` (`id`, `name`, `data`, `at`, `cron`, `catchup`) VALUES (?, ?, ?, ?, ?, ?)",
+		job.ID, job.Name, append([]byte{}, job.Data...), job.At.UnixNano(), job.Cron, int(job.Catchup))
+	return err
+}
+
+//Delete the job of id
+func (s *JobStore) Delete(id string) error {
+	_, err := s.db.Exec("DELETE FROM `"+s.table+"` WHERE `id` = ?", id)
+	return err
+}
+
+//Load all jobs
+func (s *JobStore) Load() ([]*schedule.Job, error) {
+	rows, err := s.db.Query("SELECT `id`, `name`, `data`, `at`, `cron`, `catchup` FROM `" + s.table + "`")
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*schedule.Job, 0, len(rows))
+	r := NewRow()
+	for _, row := range rows {
+		r.Reset(row)
+		job := &schedule.Job{
+			ID:      r.String("id"),
+			Name:    r.String("name"),
+			Data:    append([]byte(nil), r.Bytes("data")...),
+			At:      time.Unix(0, r.Int64("at")),
+			Cron:    r.String("cron"),
+			Catchup: schedule.Catchup(r.Int32("catchup")),
+		}
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
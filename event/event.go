@@ -0,0 +1,262 @@
+package event
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/qumi/matrix/chanrpc"
+	"github.com/qumi/matrix/conf"
+	"github.com/qumi/matrix/log"
+)
+
+type id struct{}
+
+// the function id of dispatchers on their chanrpc servers
+var ID = id{}
+
+// delivers the events published on a topic to the subscribed dispatchers,
+// events of one publisher goroutine are delivered in order
+//
+// goroutine safe
+type Bus struct {
+	mutex sync.RWMutex
+	// topic -> dispatcher -> number of subscriptions
+	subs map[string]map[*Dispatcher]int
+}
+
+var Default = NewBus()
+
+func NewBus() *Bus {
+	b := new(Bus)
+	b.subs = make(map[string]map[*Dispatcher]int)
+	return b
+}
+
+func (b *Bus) subscribe(topic string, d *Dispatcher) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	m, ok := b.subs[topic]
+	if !ok {
+		m = make(map[*Dispatcher]int)
+		b.subs[topic] = m
+	}
+	m[d]++
+}
+
+func (b *Bus) unsubscribe(topic string, d *Dispatcher) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	m, ok := b.subs[topic]
+	if !ok {
+		return
+	}
+	m[d]--
+	if m[d] <= 0 {
+		delete(m, d)
+	}
+	if len(m) == 0 {
+		delete(b.subs, topic)
+	}
+}
+
+// never blocks, events are queued by the dispatchers, so a dispatcher may
+// publish to itself
+func (b *Bus) Publish(topic string, ev interface{}) {
+	b.mutex.RLock()
+	dispatchers := make([]*Dispatcher, 0, len(b.subs[topic]))
+	for d := range b.subs[topic] {
+		dispatchers = append(dispatchers, d)
+	}
+	b.mutex.RUnlock()
+
+	for _, d := range dispatchers {
+		d.push(topic, ev)
+	}
+}
+
+// one dispatcher per chanrpc server (goroutine not safe)
+type Dispatcher struct {
+	// events published while that many are queued are dropped
+	//
+	// you must set the field before subscribing
+	MaxPending int
+
+	bus      *Bus
+	server   *chanrpc.Server
+	handlers map[string][]*Subscription
+
+	mutex     sync.Mutex
+	seq       uint64
+	pending   []delivery
+	scheduled bool
+	dropped   uint64
+}
+
+type delivery struct {
+	seq   uint64
+	topic string
+	ev    interface{}
+}
+
+type Subscription struct {
+	d     *Dispatcher
+	topic string
+	h     func(interface{})
+	// events published before are not delivered
+	seq uint64
+}
+
+// replaces the dispatcher of server, e.g. of a skeleton initialized again,
+// close the previous one first
+//
+// you must call the function before calling Open and Go of server
+func NewDispatcher(bus *Bus, server *chanrpc.Server) *Dispatcher {
+	d := new(Dispatcher)
+	d.MaxPending = 10000
+	d.bus = bus
+	d.server = server
+	d.handlers = make(map[string][]*Subscription)
+	server.Unregister(ID)
+	server.Register(ID, d.dispatch)
+	return d
+}
+
+// the chanrpc server is woken up by a goroutine, as the publisher may be
+// its own goroutine. the goroutine waits for room in ChanCall, there is one
+// at most per dispatcher as it is not started again until the events are
+// dispatched
+func (d *Dispatcher) push(topic string, ev interface{}) {
+	d.mutex.Lock()
+	if d.MaxPending > 0 && len(d.pending) >= d.MaxPending {
+		if d.dropped == 0 {
+			log.Error("event %v: %v events pending, dropping", topic, len(d.pending))
+		}
+		d.dropped++
+		d.mutex.Unlock()
+		return
+	}
+	d.seq++
+	d.pending = append(d.pending, delivery{seq: d.seq, topic: topic, ev: ev})
+	wake := !d.scheduled
+	d.scheduled = true
+	d.mutex.Unlock()
+
+	if wake {
+		go d.server.Go(ID)
+	}
+}
+
+// events dropped as MaxPending were queued
+func (d *Dispatcher) Dropped() uint64 {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.dropped
+}
+
+func (d *Dispatcher) dispatch(args []interface{}) {
+	d.mutex.Lock()
+	pending := d.pending
+	d.pending = nil
+	d.scheduled = false
+	d.mutex.Unlock()
+
+	for _, dl := range pending {
+		for _, sub := range d.handlers[dl.topic] {
+			if dl.seq > sub.seq {
+				sub.exec(dl.ev)
+			}
+		}
+	}
+}
+
+func (sub *Subscription) exec(ev interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			if conf.LenStackBuf > 0 {
+				buf := make([]byte, conf.LenStackBuf)
+				l := runtime.Stack(buf, false)
+				log.Error("event %v: %v: %s", sub.topic, r, buf[:l])
+			} else {
+				log.Error("event %v: %v", sub.topic, r)
+			}
+		}
+	}()
+
+	sub.h(ev)
+}
+
+func (d *Dispatcher) Subscribe(topic string, h func(ev interface{})) *Subscription {
+	d.mutex.Lock()
+	sub := &Subscription{d: d, topic: topic, h: h, seq: d.seq}
+	d.mutex.Unlock()
+
+	if len(d.handlers[topic]) == 0 {
+		d.bus.subscribe(topic, d)
+	}
+	d.handlers[topic] = append(d.handlers[topic], sub)
+	return sub
+}
+
+// events published before and not yet delivered are dropped
+func (sub *Subscription) Unsubscribe() {
+	d := sub.d
+	subs := d.handlers[sub.topic]
+	for i, s := range subs {
+		if s == sub {
+			subs = append(subs[:i:i], subs[i+1:]...)
+			break
+		}
+	}
+
+	if len(subs) == len(d.handlers[sub.topic]) {
+		return
+	}
+	if len(subs) == 0 {
+		delete(d.handlers, sub.topic)
+		d.bus.unsubscribe(sub.topic, d)
+	} else {
+		d.handlers[sub.topic] = subs
+	}
+}
+
+func (d *Dispatcher) Publish(topic string, ev interface{}) {
+	d.bus.Publish(topic, ev)
+}
+
+// unsubscribes all, the events pending are dropped
+func (d *Dispatcher) Close() {
+	for topic := range d.handlers {
+		d.bus.unsubscribe(topic, d)
+	}
+	d.handlers = make(map[string][]*Subscription)
+
+	d.mutex.Lock()
+	d.pending = nil
+	d.mutex.Unlock()
+}
+
+// a topic of events of type T
+type Topic[T any] struct {
+	Name string
+}
+
+func NewTopic[T any](name string) Topic[T] {
+	return Topic[T]{Name: name}
+}
+
+func Publish[T any](b *Bus, t Topic[T], ev T) {
+	b.Publish(t.Name, ev)
+}
+
+func Subscribe[T any](d *Dispatcher, t Topic[T], h func(ev T)) *Subscription {
+	return d.Subscribe(t.Name, func(ev interface{}) {
+		e, ok := ev.(T)
+		if !ok {
+			log.Error("event %v: type %T mismatch", t.Name, ev)
+			return
+		}
+		h(e)
+	})
+}
@@ -0,0 +1,80 @@
+package event_test
+
+import (
+	"fmt"
+	"github.com/qumi/matrix/chanrpc"
+	"github.com/qumi/matrix/event"
+)
+
+type Login struct {
+	Uid uint64
+}
+
+func Example() {
+	bus := event.NewBus()
+	login := event.NewTopic[Login]("login")
+
+	s := chanrpc.NewServer(10)
+	d := event.NewDispatcher(bus, s)
+
+	sub := event.Subscribe(d, login, func(ev Login) {
+		fmt.Println("login", ev.Uid)
+	})
+	d.Subscribe("logout", func(ev interface{}) {
+		fmt.Println("logout", ev)
+	})
+
+	event.Publish(bus, login, Login{Uid: 1})
+	bus.Publish("logout", 1)
+	s.Exec(<-s.ChanCall)
+
+	// not delivered
+	sub.Unsubscribe()
+	event.Publish(bus, login, Login{Uid: 2})
+	fmt.Println(len(s.ChanCall))
+
+	// Output:
+	// login 1
+	// logout 1
+	// 0
+}
+
+func ExampleDispatcher_Publish() {
+	bus := event.NewBus()
+
+	// unbuffered
+	s := chanrpc.NewServer(0)
+	d := event.NewDispatcher(bus, s)
+
+	// publishing to itself does not block
+	n := 0
+	d.Subscribe("tick", func(ev interface{}) {
+		n++
+		fmt.Println("tick", ev)
+		if n < 3 {
+			d.Publish("tick", n+1)
+		}
+	})
+	d.Publish("tick", 1)
+	for n < 3 {
+		s.Exec(<-s.ChanCall)
+	}
+
+	// events published before subscribing are not delivered
+	sub := d.Subscribe("tock", func(ev interface{}) {
+		fmt.Println("old tock", ev)
+	})
+	d.Publish("tock", 1)
+	sub.Unsubscribe()
+	d.Subscribe("tock", func(ev interface{}) {
+		fmt.Println("tock", ev)
+	})
+	d.Publish("tock", 2)
+	s.Exec(<-s.ChanCall)
+
+	// Output:
+	// tick 1
+	// tick 2
+	// tick 3
+	// tock 2
+}
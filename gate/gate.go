@@ -6,6 +6,7 @@ import (
 	"github.com/qumi/matrix/network"
 	"net"
 	"reflect"
+	"time"
 
 	"encoding/binary"
 	"fmt"
@@ -20,6 +21,13 @@ type Gate struct {
 	Processor       network.Processor
 	AgentChanRPC    *chanrpc.Server
 
+	// when set, clients must send a handshake first and the processor
+	// is selected per connection, Processor is ignored
+	Processors *network.ProcessorSet
+	// the connection is closed when no handshake is received in time,
+	// 10 seconds when 0
+	HandshakeTimeout time.Duration
+
 	ServerType uint16
 
 	// tcp
@@ -40,8 +48,8 @@ func (gate *Gate) Run(closeSig chan bool) {
 		tcpServer.MaxMsgLen = gate.MaxMsgLen
 		tcpServer.LittleEndian = gate.LittleEndian
 		tcpServer.NewAgent = func(conn *network.TCPConn) network.Agent {
-			a := &agent{conn: conn, gate: gate}
-			if gate.AgentChanRPC != nil {
+			a := &agent{conn: conn, gate: gate, processor: gate.Processor}
+			if gate.Processors == nil && gate.AgentChanRPC != nil {
 				gate.AgentChanRPC.Call0("NewAgent", a)
 			}
 			return a
@@ -76,12 +84,56 @@ func (gate *Gate) GetServerType(data []byte) (uint16, error) {
 }
 
 type agent struct {
-	conn     network.Conn
-	gate     *Gate
-	userData interface{}
+	conn      network.Conn
+	gate      *Gate
+	processor network.Processor
+	protocol  *network.Handshake
+	userData  interface{}
+}
+
+func (a *agent) handshake() bool {
+	timeout := a.gate.HandshakeTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	a.conn.SetReadDeadline(time.Now().Add(timeout))
+	data, err := a.conn.ReadMsg()
+	if err != nil {
+		log.Debug("read handshake: %v", err)
+		return false
+	}
+
+	h, err := network.ParseHandshake(data, a.gate.LittleEndian)
+	if err != nil {
+		log.Debug("parse handshake error: %v", err)
+		return false
+	}
+	p, err := a.gate.Processors.Select(h)
+	if err != nil {
+		log.Debug("handshake error: %v", err)
+		return false
+	}
+
+	err = a.conn.WriteMsg(h.Marshal(a.gate.LittleEndian))
+	if err != nil {
+		log.Debug("write handshake error: %v", err)
+		return false
+	}
+
+	a.conn.SetReadDeadline(time.Time{})
+	a.processor = p
+	a.protocol = h
+	if a.gate.AgentChanRPC != nil {
+		a.gate.AgentChanRPC.Call0("NewAgent", a)
+	}
+	return true
 }
 
 func (a *agent) Run() {
+	if a.gate.Processors != nil && !a.handshake() {
+		return
+	}
+
 	for {
 		data, err := a.conn.ReadMsg()
 		if err != nil {
@@ -100,13 +152,16 @@ func (a *agent) Run() {
 			break
 		}
 
-		if a.gate.Processor != nil {
-			msg, err := a.gate.Processor.Unmarshal(data[TypeLength:])
+		if a.processor != nil {
+			msg, err := a.processor.Unmarshal(data[TypeLength:])
 			if err != nil {
 				log.Debug("unmarshal message error: %v", err)
-				break
+				if network.Disconnect(err) {
+					break
+				}
+				continue
 			}
-			err = a.gate.Processor.Route(msg, a)
+			err = a.processor.Route(msg, a)
 			if err != nil {
 				log.Debug("route message error: %v", err)
 				break
@@ -116,6 +171,11 @@ func (a *agent) Run() {
 }
 
 func (a *agent) OnClose() {
+	// NewAgent is not called without a handshake
+	if a.gate.Processors != nil && a.protocol == nil {
+		return
+	}
+
 	if a.gate.AgentChanRPC != nil {
 		err := a.gate.AgentChanRPC.Call0("CloseAgent", a)
 		if err != nil {
@@ -125,8 +185,8 @@ func (a *agent) OnClose() {
 }
 
 func (a *agent) WriteMsg(msg interface{}) {
-	if a.gate.Processor != nil {
-		data, err := a.gate.Processor.Marshal(msg)
+	if a.processor != nil {
+		data, err := a.processor.Marshal(msg)
 		if err != nil {
 			log.Error("marshal message %v error: %v", reflect.TypeOf(msg), err)
 			return
@@ -167,6 +227,11 @@ func (a *agent) Destroy() {
 	a.conn.Destroy()
 }
 
+// nil when the gate does not negotiate protocols
+func (a *agent) Protocol() *network.Handshake {
+	return a.protocol
+}
+
 func (a *agent) UserData() interface{} {
 	return a.userData
 }
@@ -68,3 +68,86 @@ func ExampleLinearContext() {
 	// 1
 	// 2
 }
+
+func ExampleKeyedContext() {
+	d := g.New(10)
+	c := d.NewKeyedContext()
+
+	// linear per key, parallel across keys
+	c.Go(1, func() {
+		time.Sleep(time.Second / 2)
+		fmt.Println("1a")
+	}, nil)
+	c.Go(1, func() {
+		fmt.Println("1b")
+	}, nil)
+	c.Go(2, func() {
+		fmt.Println("2a")
+	}, nil)
+
+	d.Close()
+	fmt.Println(c.Len())
+
+	// Output:
+	// 2a
+	// 1a
+	// 1b
+	// 0
+}
+
+func ExamplePool() {
+	p := g.NewPool(2, 1, g.Reject)
+	d := g.NewWithPool(10, p)
+
+	release := make(chan bool)
+	for i := 0; i < 3; i++ {
+		d.Go(func() {
+			<-release
+		}, nil)
+		for i < 2 && p.Stats().Running <= int64(i) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	err := d.TryGo(func() {}, nil)
+	fmt.Println(err)
+	st := p.Stats()
+	fmt.Println(st.Running, st.Queued, st.Rejected)
+
+	close(release)
+	d.Close()
+	p.Close()
+	fmt.Println(p.Stats().Completed)
+
+	// Output:
+	// go pool full
+	// 2 1 1
+	// 3
+}
+
+func ExampleLinearContext_overflow() {
+	p := g.NewPool(4, 100, g.Block)
+	defer p.Close()
+	d := g.NewWithPool(1, p)
+	c := d.NewLinearContext()
+
+	// the callbacks overflow ChanCb
+	ran := make(chan bool)
+	for i := 0; i < 10; i++ {
+		i := i
+		c.Go(func() {
+			if i == 9 {
+				close(ran)
+			}
+		}, func() {
+			fmt.Print(i, " ")
+		})
+	}
+	<-ran
+
+	d.Close()
+	fmt.Println()
+
+	// Output:
+	// 0 1 2 3 4 5 6 7 8 9
+}
@@ -12,6 +12,11 @@ import (
 type Go struct {
 	ChanCb    chan func()
 	pendingGo int
+	pool      *Pool
+
+	// callbacks done while ChanCb is full, in order
+	mutex    sync.Mutex
+	overflow []func()
 }
 
 type LinearGo struct {
@@ -20,37 +25,110 @@ type LinearGo struct {
 }
 
 type LinearContext struct {
-	g              *Go
-	linearGo       *list.List
-	mutexLinearGo  sync.Mutex
-	mutexExecution sync.Mutex
+	g             *Go
+	linearGo      *list.List
+	mutexLinearGo sync.Mutex
+	running       bool
 }
 
 func New(l int) *Go {
+	return NewWithPool(l, nil)
+}
+
+// f runs on the pool, a goroutine per f when nil
+func NewWithPool(l int, p *Pool) *Go {
 	g := new(Go)
 	g.ChanCb = make(chan func(), l)
+	g.pool = p
 	return g
 }
 
+func (g *Go) run(task func()) error {
+	if g.pool == nil {
+		go task()
+		return nil
+	}
+	return g.pool.Submit(task)
+}
+
+// a pool worker must not wait for the goroutine of Go, which may be
+// blocked submitting to the pool. callbacks done one after another (as of a
+// linear context) are received in order
+func (g *Go) done(cb func()) {
+	if g.pool == nil {
+		g.ChanCb <- cb
+		return
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if len(g.overflow) == 0 {
+		select {
+		case g.ChanCb <- cb:
+			return
+		default:
+		}
+		go g.drain()
+	}
+	g.overflow = append(g.overflow, cb)
+}
+
+func (g *Go) drain() {
+	g.mutex.Lock()
+	for len(g.overflow) > 0 {
+		cb := g.overflow[0]
+		g.mutex.Unlock()
+		g.ChanCb <- cb
+		g.mutex.Lock()
+		g.overflow = g.overflow[1:]
+	}
+	g.overflow = nil
+	g.mutex.Unlock()
+}
+
+func exec(f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			if conf.LenStackBuf > 0 {
+				buf := make([]byte, conf.LenStackBuf)
+				l := runtime.Stack(buf, false)
+				log.Error("%v: %s", r, buf[:l])
+			} else {
+				log.Error("%v", r)
+			}
+		}
+	}()
+
+	f()
+}
+
+// cb is called even if the pool rejects f
 func (g *Go) Go(f func(), cb func()) {
 	g.pendingGo++
 
-	go func() {
-		defer func() {
-			g.ChanCb <- cb
-			if r := recover(); r != nil {
-				if conf.LenStackBuf > 0 {
-					buf := make([]byte, conf.LenStackBuf)
-					l := runtime.Stack(buf, false)
-					log.Error("%v: %s", r, buf[:l])
-				} else {
-					log.Error("%v", r)
-				}
-			}
-		}()
+	err := g.run(func() {
+		exec(f)
+		g.done(cb)
+	})
+	if err != nil {
+		log.Error("%v", err)
+		g.done(cb)
+	}
+}
 
-		f()
-	}()
+// nothing is called when the pool rejects f
+func (g *Go) TryGo(f func(), cb func()) error {
+	g.pendingGo++
+
+	err := g.run(func() {
+		exec(f)
+		g.done(cb)
+	})
+	if err != nil {
+		g.pendingGo--
+	}
+	return err
 }
 
 func (g *Go) Cb(cb func()) {
@@ -89,34 +167,44 @@ func (g *Go) NewLinearContext() *LinearContext {
 	return c
 }
 
+// cb is called even if the pool rejects f
 func (c *LinearContext) Go(f func(), cb func()) {
 	c.g.pendingGo++
 
 	c.mutexLinearGo.Lock()
 	c.linearGo.PushBack(&LinearGo{f: f, cb: cb})
+	if c.running {
+		c.mutexLinearGo.Unlock()
+		return
+	}
+	c.running = true
 	c.mutexLinearGo.Unlock()
 
-	go func() {
-		c.mutexExecution.Lock()
-		defer c.mutexExecution.Unlock()
+	// one task at a time runs the queue, so no worker waits for another
+	err := c.g.run(c.drain)
+	if err != nil {
+		c.mutexLinearGo.Lock()
+		e := c.linearGo.Remove(c.linearGo.Back()).(*LinearGo)
+		c.running = false
+		c.mutexLinearGo.Unlock()
+
+		log.Error("%v", err)
+		c.g.done(e.cb)
+	}
+}
 
+func (c *LinearContext) drain() {
+	for {
 		c.mutexLinearGo.Lock()
+		if c.linearGo.Len() == 0 {
+			c.running = false
+			c.mutexLinearGo.Unlock()
+			return
+		}
 		e := c.linearGo.Remove(c.linearGo.Front()).(*LinearGo)
 		c.mutexLinearGo.Unlock()
 
-		defer func() {
-			c.g.ChanCb <- e.cb
-			if r := recover(); r != nil {
-				if conf.LenStackBuf > 0 {
-					buf := make([]byte, conf.LenStackBuf)
-					l := runtime.Stack(buf, false)
-					log.Error("%v: %s", r, buf[:l])
-				} else {
-					log.Error("%v", r)
-				}
-			}
-		}()
-
-		e.f()
-	}()
+		exec(e.f)
+		c.g.done(e.cb)
+	}
 }
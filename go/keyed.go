@@ -0,0 +1,84 @@
+package g
+
+import (
+	"container/list"
+	"github.com/qumi/matrix/log"
+	"sync"
+)
+
+// tasks of a key run one at a time in order, tasks of different keys run
+// concurrently, on the pool of Go if any. a key is dropped once its tasks
+// are done
+type KeyedContext struct {
+	g     *Go
+	mutex sync.Mutex
+	keys  map[interface{}]*list.List
+}
+
+func (g *Go) NewKeyedContext() *KeyedContext {
+	c := new(KeyedContext)
+	c.g = g
+	c.keys = make(map[interface{}]*list.List)
+	return c
+}
+
+// cb is called even if the pool rejects f
+func (c *KeyedContext) Go(key interface{}, f func(), cb func()) {
+	c.g.pendingGo++
+
+	c.mutex.Lock()
+	q, ok := c.keys[key]
+	if ok {
+		q.PushBack(&LinearGo{f: f, cb: cb})
+		c.mutex.Unlock()
+		return
+	}
+	q = list.New()
+	q.PushBack(&LinearGo{f: f, cb: cb})
+	c.keys[key] = q
+	c.mutex.Unlock()
+
+	err := c.g.run(func() {
+		c.drain(key, q)
+	})
+	if err != nil {
+		c.mutex.Lock()
+		delete(c.keys, key)
+		c.mutex.Unlock()
+
+		log.Error("%v", err)
+		c.g.done(cb)
+	}
+}
+
+// the task running stays in the queue, so Go does not start another drain
+// for the key
+func (c *KeyedContext) drain(key interface{}, q *list.List) {
+	for {
+		c.mutex.Lock()
+		e := q.Front().Value.(*LinearGo)
+		c.mutex.Unlock()
+
+		exec(e.f)
+
+		c.mutex.Lock()
+		q.Remove(q.Front())
+		idle := q.Len() == 0
+		if idle {
+			delete(c.keys, key)
+		}
+		c.mutex.Unlock()
+
+		c.g.done(e.cb)
+		if idle {
+			return
+		}
+	}
+}
+
+// the number of keys with tasks not done
+func (c *KeyedContext) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.keys)
+}
@@ -0,0 +1,112 @@
+package g
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrRejected = errors.New("go pool full")
+	ErrClosed   = errors.New("go pool closed")
+)
+
+// what Submit does when the queue is full
+type Policy int
+
+const (
+	Block Policy = iota
+	Reject
+)
+
+type PoolStats struct {
+	Size      int
+	Queued    int64
+	Running   int64
+	Completed int64
+	Rejected  int64
+}
+
+// a fixed number of goroutines running the tasks submitted, may be shared
+// by many Go
+//
+// goroutine safe
+type Pool struct {
+	size      int
+	policy    Policy
+	tasks     chan func()
+	wg        sync.WaitGroup
+	queued    int64
+	running   int64
+	completed int64
+	rejected  int64
+}
+
+func NewPool(size int, queueLen int, policy Policy) *Pool {
+	if size <= 0 {
+		size = 1
+	}
+
+	p := new(Pool)
+	p.size = size
+	p.policy = policy
+	p.tasks = make(chan func(), queueLen)
+	for i := 0; i < size; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+
+	for task := range p.tasks {
+		atomic.AddInt64(&p.queued, -1)
+		atomic.AddInt64(&p.running, 1)
+		task()
+		atomic.AddInt64(&p.running, -1)
+		atomic.AddInt64(&p.completed, 1)
+	}
+}
+
+// the task must not panic
+func (p *Pool) Submit(task func()) (err error) {
+	defer func() {
+		if recover() != nil {
+			atomic.AddInt64(&p.queued, -1)
+			err = ErrClosed
+		}
+	}()
+
+	atomic.AddInt64(&p.queued, 1)
+	if p.policy == Block {
+		p.tasks <- task
+		return nil
+	}
+
+	select {
+	case p.tasks <- task:
+		return nil
+	default:
+		atomic.AddInt64(&p.queued, -1)
+		atomic.AddInt64(&p.rejected, 1)
+		return ErrRejected
+	}
+}
+
+func (p *Pool) Stats() PoolStats {
+	return PoolStats{
+		Size:      p.size,
+		Queued:    atomic.LoadInt64(&p.queued),
+		Running:   atomic.LoadInt64(&p.running),
+		Completed: atomic.LoadInt64(&p.completed),
+		Rejected:  atomic.LoadInt64(&p.rejected),
+	}
+}
+
+// the tasks queued are run before the function returns
+func (p *Pool) Close() {
+	close(p.tasks)
+	p.wg.Wait()
+}
@@ -0,0 +1,86 @@
+package matrix
+
+import (
+	"runtime"
+	"sort"
+
+	"github.com/qumi/matrix/conf"
+	"github.com/qumi/matrix/log"
+)
+
+type hook struct {
+	name     string
+	priority int
+	f        func()
+}
+
+type hooks []*hook
+
+func (hs hooks) sorted() hooks {
+	s := append(hooks(nil), hs...)
+	sort.SliceStable(s, func(i, j int) bool {
+		return s[i].priority > s[j].priority
+	})
+	return s
+}
+
+func (hs hooks) run(kind string) {
+	for _, h := range hs {
+		h.run(kind)
+	}
+}
+
+func (h *hook) run(kind string) {
+	defer func() {
+		if r := recover(); r != nil {
+			if conf.LenStackBuf > 0 {
+				buf := make([]byte, conf.LenStackBuf)
+				l := runtime.Stack(buf, false)
+				log.Error("%v hook %v: %v: %s", kind, h.name, r, buf[:l])
+			} else {
+				log.Error("%v hook %v: %v", kind, h.name, r)
+			}
+		}
+	}()
+
+	h.f()
+}
+
+// hooks run on Stop before the modules are destroyed, higher priorities
+// first, equal priorities in registration order
+//
+// goroutine safe
+func (app *Application) OnShutdown(name string, priority int, f func()) {
+	app.mutex.Lock()
+	defer app.mutex.Unlock()
+
+	app.shutdownHooks = append(app.shutdownHooks, &hook{name: name, priority: priority, f: f})
+}
+
+// hooks run on Reload in registration order, Run reloads on SIGHUP
+//
+// goroutine safe
+func (app *Application) OnReload(name string, f func()) {
+	app.mutex.Lock()
+	defer app.mutex.Unlock()
+
+	app.reloadHooks = append(app.reloadHooks, &hook{name: name, f: f})
+}
+
+// goroutine safe
+func (app *Application) Reload() {
+	app.mutex.Lock()
+	hs := app.reloadHooks
+	app.mutex.Unlock()
+
+	hs.run("reload")
+}
+
+// hooks of the application started by Run
+func OnShutdown(name string, priority int, f func()) {
+	Default.OnShutdown(name, priority, f)
+}
+
+func OnReload(name string, f func()) {
+	Default.OnReload(name, f)
+}
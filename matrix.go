@@ -3,15 +3,19 @@ package matrix
 import (
 	"os"
 	"os/signal"
+	"strconv"
+	"syscall"
 
-	"github.com/qumi/matrix/cluster"
 	"github.com/qumi/matrix/conf"
-	"github.com/qumi/matrix/console"
 	"github.com/qumi/matrix/log"
 	"github.com/qumi/matrix/module"
 )
 
+// runs Default until SIGINT or SIGTERM, SIGHUP reloads it
 func Run(mods ...module.Module) {
+	app := Default
+	app.ShutdownTimeout = conf.ShutdownTimeout
+
 	// logger
 	if conf.LogLevel != "" {
 		logger, err := log.New(conf.LogLevel, conf.LogPath, conf.LogFlag)
@@ -22,26 +26,48 @@ func Run(mods ...module.Module) {
 		defer logger.Close()
 	}
 
-	log.Release("matrix %v starting up", version)
+	// console
+	if conf.ConsolePort != 0 {
+		app.ConsoleAddr = "localhost:" + strconv.Itoa(conf.ConsolePort)
+		app.ConsolePrompt = conf.ConsolePrompt
+	}
 
 	// module
-	for i := 0; i < len(mods); i++ {
-		module.Register(mods[i])
+	app.Register(mods...)
+	err := app.Start()
+	if err != nil {
+		log.Fatal("%v", err)
 	}
-	module.Init()
-
-	// cluster
-	cluster.Init()
-
-	// console
-	console.Init()
 
 	// close
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, os.Kill)
-	sig := <-c
-	log.Release("matrix closing down (signal: %v)", sig)
-	console.Destroy()
-	cluster.Destroy()
-	module.Destroy()
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for closing := false; !closing; {
+		select {
+		case sig := <-c:
+			if sig == syscall.SIGHUP {
+				log.Release("matrix reloading (signal: %v)", sig)
+				app.Reload()
+				continue
+			}
+			log.Release("matrix closing down (signal: %v)", sig)
+		case err := <-app.Escalation():
+			log.Error("matrix closing down (%v)", err)
+		}
+		closing = true
+	}
+
+	// a second signal forces the exit
+	go func() {
+		for sig := range c {
+			if sig != syscall.SIGHUP {
+				log.Fatal("matrix forced down (signal: %v)", sig)
+			}
+		}
+	}()
+
+	err = app.Stop()
+	if err != nil {
+		log.Fatal("%v", err)
+	}
 }
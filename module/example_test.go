@@ -0,0 +1,257 @@
+package module_test
+
+import (
+	"fmt"
+	"github.com/qumi/matrix/chanrpc"
+	"github.com/qumi/matrix/event"
+	"github.com/qumi/matrix/module"
+	"time"
+)
+
+func ExampleFuture() {
+	db := chanrpc.NewServer(10)
+	db.Register("load", func(args []interface{}) interface{} {
+		return args[0].(int) * 10
+	})
+	go func() {
+		for ci := range db.ChanCall {
+			db.Exec(ci)
+		}
+	}()
+
+	s := &module.Skeleton{AsynCallLen: 10, GoLen: 10, TimerDispatcherLen: 10}
+	s.Init()
+	closeSig := make(chan bool, 1)
+	done := make(chan bool)
+
+	s.Go(func() {}, func() {
+		a := s.AsynCallFuture(db, "load", 1)
+		b := a.Then(func(ret interface{}) *module.Future {
+			return s.AsynCallFuture(db, "load", ret)
+		})
+
+		s.All(a, b).OnDone(func(ret interface{}, err error) {
+			fmt.Println(ret, err)
+
+			s.AsynCallFuture(db, "unknown").OnDone(func(ret interface{}, err error) {
+				fmt.Println(ret, err)
+				close(done)
+			})
+		})
+	})
+
+	go s.Run(closeSig)
+	<-done
+	closeSig <- true
+
+	// Output:
+	// [10 100] <nil>
+	// <nil> function id unknown: function not registered
+}
+
+func ExampleFuture_Then() {
+	s := new(module.Skeleton)
+	print := func(ret interface{}, err error) {
+		fmt.Println(ret, err)
+	}
+
+	f, resolve := s.NewFuture()
+	f.Then(func(ret interface{}) *module.Future {
+		// nothing to wait for
+		return nil
+	}).OnDone(print)
+	resolve(1, nil)
+
+	s.Any().OnDone(print)
+
+	// Output:
+	// <nil> <nil>
+	// <nil> no futures
+}
+
+type mod struct {
+	name string
+	deps []string
+}
+
+func (m *mod) Name() string        { return m.name }
+func (m *mod) DependsOn() []string { return m.deps }
+func (m *mod) OnInit()             { fmt.Println("init", m.name) }
+func (m *mod) OnDestroy()          { fmt.Println("destroy", m.name) }
+func (m *mod) Run(closeSig chan bool) {
+	<-closeSig
+}
+
+func ExampleInit() {
+	module.Register(&mod{name: "game", deps: []string{"db", "login"}})
+	module.Register(&mod{name: "login", deps: []string{"db"}})
+	module.Register(&mod{name: "db"})
+
+	err := module.Init()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, info := range module.Infos() {
+		fmt.Println(info.Name, info.State)
+	}
+
+	module.Destroy()
+	state, _ := module.StateOf("game")
+	fmt.Println(state)
+
+	// Output:
+	// init db
+	// init login
+	// init game
+	// db running
+	// login running
+	// game running
+	// destroy game
+	// destroy login
+	// destroy db
+	// stopped
+}
+
+func ExampleManager() {
+	a := module.NewManager()
+	a.Register(&mod{name: "a"})
+	b := module.NewManager()
+	b.Register(&mod{name: "b"})
+
+	a.Init()
+	b.Init()
+	a.Destroy()
+	fmt.Println(a.StateOf("a"))
+	fmt.Println(b.StateOf("b"))
+	b.Destroy()
+
+	// Output:
+	// init a
+	// init b
+	// destroy a
+	// stopped true
+	// running true
+	// destroy b
+}
+
+func ExampleHealthOf() {
+	s := &module.Skeleton{Name: "health", ChanRPCServer: chanrpc.NewServer(10)}
+	s.Init()
+	s.RegisterChanRPC("ping", func(args []interface{}) {})
+	closeSig := make(chan bool, 1)
+	done := make(chan bool)
+	go func() {
+		s.Run(closeSig)
+		close(done)
+	}()
+	// reported once running
+	s.ChanRPCServer.Call0("ping")
+
+	health := func() {
+		for _, h := range module.HealthOf() {
+			if h.Name == s.Name {
+				fmt.Println(h.Name, h.Healthy)
+			}
+		}
+	}
+	health()
+
+	// not reported once closed
+	closeSig <- true
+	<-done
+	health()
+	fmt.Println("closed")
+
+	// Output:
+	// health true
+	// closed
+}
+
+// returns without waiting for closeSig
+type oneShot struct {
+	mod
+}
+
+func (m *oneShot) Run(closeSig chan bool) {}
+
+func ExampleManager_Destroy() {
+	mgr := module.NewManager()
+	mgr.Register(&oneShot{mod{name: "once"}})
+	mgr.Init()
+
+	for {
+		state, _ := mgr.StateOf("once")
+		if state != module.StateRunning {
+			fmt.Println(state)
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	mgr.Destroy()
+
+	// Output:
+	// init once
+	// stopped
+	// destroy once
+}
+
+// not Named
+type plain struct{}
+
+func (m *plain) OnInit()                {}
+func (m *plain) OnDestroy()             {}
+func (m *plain) Run(closeSig chan bool) { <-closeSig }
+
+func ExampleManager_Register() {
+	mgr := module.NewManager()
+	mgr.Register(new(plain))
+	mgr.Register(&mod{name: "a"})
+	mgr.Register(new(plain))
+
+	fmt.Println(mgr.Init())
+	for _, info := range mgr.Infos() {
+		fmt.Println(info.Name)
+	}
+	mgr.Destroy()
+
+	// names given by Named are unique
+	mgr = module.NewManager()
+	mgr.Register(&mod{name: "a"})
+	mgr.Register(&mod{name: "a"})
+	fmt.Println(mgr.Init())
+
+	// Output:
+	// init a
+	// <nil>
+	// *module_test.plain
+	// a
+	// *module_test.plain#2
+	// destroy a
+	// module a is already registered
+}
+
+func ExampleSkeleton_Init() {
+	s := &module.Skeleton{ChanRPCServer: chanrpc.NewServer(10), EventBus: event.NewBus()}
+	s.Init()
+	s.Subscribe("restart", func(ev interface{}) {
+		fmt.Println("closed subscription", ev)
+	})
+
+	// e.g. by a restart, on the same server
+	s.Init()
+	done := make(chan bool)
+	s.Subscribe("restart", func(ev interface{}) {
+		fmt.Println("restart", ev)
+		close(done)
+	})
+
+	closeSig := make(chan bool, 1)
+	go s.Run(closeSig)
+	s.Publish("restart", 1)
+	<-done
+	closeSig <- true
+
+	// Output:
+	// restart 1
+}
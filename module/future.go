@@ -0,0 +1,202 @@
+package module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/qumi/matrix/chanrpc"
+	"github.com/qumi/matrix/conf"
+	"github.com/qumi/matrix/log"
+	"runtime"
+	"time"
+)
+
+// the result of an asynchronous operation, resolved and continued on the
+// goroutine of the skeleton (goroutine not safe)
+type Future struct {
+	s       *Skeleton
+	done    bool
+	ret     interface{}
+	err     error
+	waiters []func(interface{}, error)
+}
+
+// resolve must be called on the goroutine of the skeleton, only the first
+// call takes effect
+func (s *Skeleton) NewFuture() (f *Future, resolve func(ret interface{}, err error)) {
+	f = &Future{s: s}
+	return f, f.resolve
+}
+
+func (f *Future) resolve(ret interface{}, err error) {
+	if f.done {
+		return
+	}
+	f.done = true
+	f.ret = ret
+	f.err = err
+
+	waiters := f.waiters
+	f.waiters = nil
+	for _, w := range waiters {
+		execWaiter(w, ret, err)
+	}
+}
+
+func execWaiter(w func(interface{}, error), ret interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if conf.LenStackBuf > 0 {
+				buf := make([]byte, conf.LenStackBuf)
+				l := runtime.Stack(buf, false)
+				log.Error("%v: %s", r, buf[:l])
+			} else {
+				log.Error("%v", r)
+			}
+		}
+	}()
+
+	w(ret, err)
+}
+
+func (f *Future) Done() bool {
+	return f.done
+}
+
+// valid when done
+func (f *Future) Result() (interface{}, error) {
+	return f.ret, f.err
+}
+
+// cb is called when f is done, immediately if it is already
+func (f *Future) OnDone(cb func(ret interface{}, err error)) {
+	if f.done {
+		execWaiter(cb, f.ret, f.err)
+		return
+	}
+	f.waiters = append(f.waiters, cb)
+}
+
+// next is called with the result of f when it succeeds, the returned
+// future is resolved with the result of the future returned by next,
+// (nil, nil) when next returns nil, the panic of next, or the error of f
+func (f *Future) Then(next func(ret interface{}) *Future) *Future {
+	nf, resolve := f.s.NewFuture()
+	f.OnDone(func(ret interface{}, err error) {
+		if err != nil {
+			resolve(nil, err)
+			return
+		}
+
+		defer func() {
+			if r := recover(); r != nil {
+				resolve(nil, fmt.Errorf("%v", r))
+				panic(r)
+			}
+		}()
+
+		f := next(ret)
+		if f == nil {
+			resolve(nil, nil)
+			return
+		}
+		f.OnDone(resolve)
+	})
+	return nf
+}
+
+// the returned future fails with chanrpc.ErrTimeout if f is not done in d
+func (f *Future) Timeout(d time.Duration) *Future {
+	nf, resolve := f.s.NewFuture()
+	t := f.s.AfterFunc(d, func() {
+		resolve(nil, chanrpc.ErrTimeout)
+	})
+	f.OnDone(func(ret interface{}, err error) {
+		t.Stop()
+		resolve(ret, err)
+	})
+	return nf
+}
+
+// resolved with the results of fs in order, or with the first error
+func (s *Skeleton) All(fs ...*Future) *Future {
+	nf, resolve := s.NewFuture()
+	rets := make([]interface{}, len(fs))
+	n := len(fs)
+	if n == 0 {
+		resolve(rets, nil)
+		return nf
+	}
+
+	for i, f := range fs {
+		i := i
+		f.OnDone(func(ret interface{}, err error) {
+			if err != nil {
+				resolve(nil, err)
+				return
+			}
+			rets[i] = ret
+			n--
+			if n == 0 {
+				resolve(rets, nil)
+			}
+		})
+	}
+	return nf
+}
+
+// resolved with the first successful result of fs, or with the last error,
+// fails without fs
+func (s *Skeleton) Any(fs ...*Future) *Future {
+	nf, resolve := s.NewFuture()
+	n := len(fs)
+	if n == 0 {
+		resolve(nil, errors.New("no futures"))
+		return nf
+	}
+
+	for _, f := range fs {
+		f.OnDone(func(ret interface{}, err error) {
+			n--
+			if err == nil || n == 0 {
+				resolve(ret, err)
+			}
+		})
+	}
+	return nf
+}
+
+func (s *Skeleton) AsynCallFuture(server *chanrpc.Server, id interface{}, args ...interface{}) *Future {
+	return s.AsynCallFutureContext(context.Background(), server, id, args...)
+}
+
+func (s *Skeleton) AsynCallFutureContext(ctx context.Context, server *chanrpc.Server, id interface{}, args ...interface{}) *Future {
+	if s.AsynCallLen == 0 {
+		panic("invalid AsynCallLen")
+	}
+
+	f, resolve := s.NewFuture()
+	s.client.Attach(server)
+	s.client.AsynCallAny(ctx, id, args, resolve)
+	return f
+}
+
+// f is executed by Go, the future is resolved with its result
+func (s *Skeleton) GoFuture(f func() (interface{}, error)) *Future {
+	nf, resolve := s.NewFuture()
+	var ret interface{}
+	var err error
+	s.Go(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%v", r)
+				panic(r)
+			}
+		}()
+
+		ret, err = f()
+	}, func() {
+		resolve(ret, err)
+	})
+	return nf
+}
@@ -1,10 +1,14 @@
 package module
 
 import (
+	"fmt"
+	"github.com/qumi/matrix/clock"
 	"github.com/qumi/matrix/conf"
 	"github.com/qumi/matrix/log"
 	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 type Module interface {
@@ -13,45 +17,360 @@ type Module interface {
 	Run(closeSig chan bool)
 }
 
+// optionally implemented by modules, the name defaults to the type name
+type Named interface {
+	Name() string
+}
+
+// optionally implemented by modules, named modules initialized before
+// and destroyed after the module
+type Dependent interface {
+	DependsOn() []string
+}
+
+type State int32
+
+const (
+	StateRegistered State = iota
+	StateInitializing
+	StateRunning
+	StateStopping
+	StateStopped
+	StateFailed
+	StateRestarting
+)
+
+func (s State) String() string {
+	switch s {
+	case StateRegistered:
+		return "registered"
+	case StateInitializing:
+		return "initializing"
+	case StateRunning:
+		return "running"
+	case StateStopping:
+		return "stopping"
+	case StateStopped:
+		return "stopped"
+	case StateFailed:
+		return "failed"
+	case StateRestarting:
+		return "restarting"
+	default:
+		return fmt.Sprintf("State(%d)", int32(s))
+	}
+}
+
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+type Info struct {
+	Name      string
+	DependsOn []string
+	State     State
+}
+
 type module struct {
 	mi       Module
+	name     string
+	named    bool
+	deps     []string
+	mgr      *Manager
+	policy   RestartPolicy
+	inited   bool
+	state    int32
 	closeSig chan bool
 	wg       sync.WaitGroup
 }
 
-var mods []*module
+// a set of modules with their lifecycle, Default backs the package-level
+// functions
+type Manager struct {
+	// of the restart windows and backoffs, the real clock when nil
+	//
+	// you must set the field before calling Init
+	Clock clock.Clock
+
+	mutex      sync.RWMutex
+	mods       []*module
+	escalation chan error
+}
+
+var Default = NewManager()
+
+func NewManager() *Manager {
+	mgr := new(Manager)
+	mgr.escalation = make(chan error, 1)
+	return mgr
+}
+
+func (mgr *Manager) clock() clock.Clock {
+	if mgr.Clock == nil {
+		return clock.Real
+	}
+	return mgr.Clock
+}
 
 func Register(mi Module) {
+	Default.Register(mi)
+}
+
+func Init() error {
+	return Default.Init()
+}
+
+func Destroy() {
+	Default.Destroy()
+}
+
+// goroutine safe
+func Infos() []Info {
+	return Default.Infos()
+}
+
+// goroutine safe
+func StateOf(name string) (State, bool) {
+	return Default.StateOf(name)
+}
+
+func (mgr *Manager) Register(mi Module) {
 	m := new(module)
 	m.mi = mi
+	m.mgr = mgr
 	m.closeSig = make(chan bool, 1)
 
-	mods = append(mods, m)
+	if n, ok := mi.(Named); ok {
+		m.name = n.Name()
+		m.named = true
+	} else {
+		m.name = fmt.Sprintf("%T", mi)
+	}
+	if d, ok := mi.(Dependent); ok {
+		m.deps = d.DependsOn()
+	}
+	m.policy = DefaultRestartPolicy
+	if s, ok := mi.(Supervised); ok {
+		m.policy = s.RestartPolicy()
+	}
+
+	mgr.mutex.Lock()
+	mgr.mods = append(mgr.mods, m)
+	mgr.mutex.Unlock()
+}
+
+func (m *module) setState(s State) {
+	atomic.StoreInt32(&m.state, int32(s))
+}
+
+func (m *module) getState() State {
+	return State(atomic.LoadInt32(&m.state))
 }
 
-func Init() {
+// modules in initialization order once Init is called
+//
+// goroutine safe
+func (mgr *Manager) Infos() []Info {
+	mgr.mutex.RLock()
+	defer mgr.mutex.RUnlock()
+
+	infos := make([]Info, len(mgr.mods))
+	for i, m := range mgr.mods {
+		infos[i] = Info{Name: m.name, DependsOn: m.deps, State: m.getState()}
+	}
+	return infos
+}
+
+// goroutine safe
+func (mgr *Manager) StateOf(name string) (State, bool) {
+	mgr.mutex.RLock()
+	defer mgr.mutex.RUnlock()
+
+	for _, m := range mgr.mods {
+		if m.name == name {
+			return m.getState(), true
+		}
+	}
+	return 0, false
+}
+
+// dependencies first, otherwise in registration order. names must be
+// unique when given by Named or depended on, modules of a type registered
+// again are named type#index otherwise
+func sortMods(mods []*module) ([]*module, error) {
+	dependedOn := make(map[string]bool)
+	for _, m := range mods {
+		for _, dep := range m.deps {
+			dependedOn[dep] = true
+		}
+	}
+
+	byName := make(map[string]*module)
+	for i, m := range mods {
+		if other, ok := byName[m.name]; ok {
+			if m.named || other.named || dependedOn[m.name] {
+				return nil, fmt.Errorf("module %v is already registered", m.name)
+			}
+			m.name = fmt.Sprintf("%v#%v", m.name, i)
+		}
+		byName[m.name] = m
+	}
+	for _, m := range mods {
+		for _, dep := range m.deps {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("module %v depends on unregistered module %v", m.name, dep)
+			}
+		}
+	}
+
+	sorted := make([]*module, 0, len(mods))
+	done := make(map[string]bool)
+	for len(sorted) < len(mods) {
+		progress := false
+		for _, m := range mods {
+			if done[m.name] {
+				continue
+			}
+			ready := true
+			for _, dep := range m.deps {
+				if !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				done[m.name] = true
+				sorted = append(sorted, m)
+				progress = true
+			}
+		}
+
+		if !progress {
+			return nil, fmt.Errorf("module dependency cycle: %v", cycle(mods, byName, done))
+		}
+	}
+
+	return sorted, nil
+}
+
+func cycle(mods []*module, byName map[string]*module, done map[string]bool) string {
+	// every module left has a dependency left, so walking them loops
+	var m *module
+	for _, m = range mods {
+		if !done[m.name] {
+			break
+		}
+	}
+
+	visited := make(map[string]int)
+	var path []string
+	for {
+		if i, ok := visited[m.name]; ok {
+			return strings.Join(append(path[i:], m.name), " -> ")
+		}
+		visited[m.name] = len(path)
+		path = append(path, m.name)
+
+		for _, dep := range m.deps {
+			if !done[dep] {
+				m = byName[dep]
+				break
+			}
+		}
+	}
+}
+
+// modules initialized before a failure are destroyed
+func (mgr *Manager) Init() error {
+	mgr.mutex.Lock()
+	sorted, err := sortMods(mgr.mods)
+	if err == nil {
+		mgr.mods = sorted
+	}
+	mgr.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	mods := sorted
 	for i := 0; i < len(mods); i++ {
-		mods[i].mi.OnInit()
+		m := mods[i]
+		m.setState(StateInitializing)
+		err := initialize(m)
+		if err != nil {
+			m.setState(StateFailed)
+			for j := i - 1; j >= 0; j-- {
+				mods[j].setState(StateStopping)
+				destroy(mods[j])
+				mods[j].inited = false
+				mods[j].setState(StateStopped)
+			}
+			return fmt.Errorf("module %v OnInit: %v", m.name, err)
+		}
+		m.inited = true
 	}
 
 	for i := 0; i < len(mods); i++ {
 		m := mods[i]
+		m.setState(StateRunning)
 		m.wg.Add(1)
 		go run(m)
 	}
+
+	startWatchdog(mgr)
+	return nil
 }
 
-func Destroy() {
+func (mgr *Manager) Destroy() {
+	stopWatchdog(mgr)
+
+	mgr.mutex.RLock()
+	mods := mgr.mods
+	mgr.mutex.RUnlock()
+
 	for i := len(mods) - 1; i >= 0; i-- {
 		m := mods[i]
-		m.closeSig <- true
+		switch m.getState() {
+		case StateRegistered:
+			continue
+		case StateStopped:
+			// Run returned, OnDestroy is still called
+			if !m.inited {
+				continue
+			}
+		default:
+			m.setState(StateStopping)
+			m.closeSig <- true
+		}
 		m.wg.Wait()
-		destroy(m)
+		if m.inited {
+			destroy(m)
+			m.inited = false
+		}
+		m.setState(StateStopped)
 	}
 }
 
+func initialize(m *module) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if conf.LenStackBuf > 0 {
+				buf := make([]byte, conf.LenStackBuf)
+				l := runtime.Stack(buf, false)
+				log.Error("%v: %s", r, buf[:l])
+			} else {
+				log.Error("%v", r)
+			}
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	m.mi.OnInit()
+	return nil
+}
+
 func run(m *module) {
-	m.mi.Run(m.closeSig)
+	supervise(m)
 	m.wg.Done()
 }
 
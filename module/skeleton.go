@@ -1,23 +1,41 @@
 package module
 
 import (
+	"context"
 	"github.com/qumi/matrix/chanrpc"
+	"github.com/qumi/matrix/clock"
 	"github.com/qumi/matrix/console"
+	"github.com/qumi/matrix/event"
 	"github.com/qumi/matrix/go"
+	"github.com/qumi/matrix/log"
 	"github.com/qumi/matrix/timer"
 	"time"
 )
 
 type Skeleton struct {
+	// timers on a timing wheel of the tick when not 0, for many timers
+	TimerWheelTick time.Duration
+	// of the timers, the real clock when nil
+	Clock clock.Clock
+	// runs Go and linear contexts, a goroutine per call when nil
+	GoPool *g.Pool
+	// stats of the chanrpc server are queryable from the console by name
+	Name string
+	// commands are served by the console, by all consoles when nil
+	Console            *console.Console
 	GoLen              int
 	TimerDispatcherLen int
 	AsynCallLen        int
 	ChanRPCServer      *chanrpc.Server
+	EventBus           *event.Bus
 	g                  *g.Go
 	dispatcher         *timer.Dispatcher
 	client             *chanrpc.Client
 	server             *chanrpc.Server
 	commandServer      *chanrpc.Server
+	events             *event.Dispatcher
+	watch              *watch
+	monitored          bool
 }
 
 func (s *Skeleton) Init() {
@@ -31,8 +49,15 @@ func (s *Skeleton) Init() {
 		s.AsynCallLen = 0
 	}
 
-	s.g = g.New(s.GoLen)
-	s.dispatcher = timer.NewDispatcher(s.TimerDispatcherLen)
+	s.g = g.NewWithPool(s.GoLen, s.GoPool)
+	if s.Clock == nil {
+		s.Clock = clock.Real
+	}
+	if s.TimerWheelTick > 0 {
+		s.dispatcher = timer.NewWheelDispatcherClock(s.TimerDispatcherLen, s.TimerWheelTick, s.Clock)
+	} else {
+		s.dispatcher = timer.NewDispatcherClock(s.TimerDispatcherLen, s.Clock)
+	}
 	s.client = chanrpc.NewClient(s.AsynCallLen)
 	s.server = s.ChanRPCServer
 
@@ -40,12 +65,40 @@ func (s *Skeleton) Init() {
 		s.server = chanrpc.NewServer(0)
 	}
 	s.commandServer = chanrpc.NewServer(0)
+
+	if s.EventBus == nil {
+		s.EventBus = event.Default
+	}
+	// initialized again, e.g. by a restart
+	if s.events != nil {
+		s.events.Close()
+	}
+	s.events = event.NewDispatcher(s.EventBus, s.server)
+
+	if s.Name != "" {
+		err := chanrpc.Monitor(s.Name, s.server, s.client)
+		if err != nil {
+			log.Error("skeleton %v: %v", s.Name, err)
+		}
+		s.monitored = err == nil
+	}
 }
 
 func (s *Skeleton) Run(closeSig chan bool) {
+	// deadlocks of timers, Go callbacks and events before the first call
+	s.server.Own()
+	s.commandServer.Own()
+	// watched while running only
+	s.watch = newWatch(s.Name)
+	s.watch.start()
+	defer s.watch.close()
+	defer s.unmonitor()
+
 	for {
 		select {
 		case <-closeSig:
+			s.events.Close()
+			s.dispatcher.Close()
 			s.commandServer.Close()
 			s.server.Close()
 			for !s.g.Idle() || !s.client.Idle() {
@@ -54,19 +107,37 @@ func (s *Skeleton) Run(closeSig chan bool) {
 			}
 			return
 		case ri := <-s.client.ChanAsynRet:
+			s.watch.enter()
 			s.client.Cb(ri)
+			s.watch.leave()
 		case ci := <-s.server.ChanCall:
+			s.watch.enter()
 			s.server.Exec(ci)
+			s.watch.leave()
 		case ci := <-s.commandServer.ChanCall:
+			s.watch.enter()
 			s.commandServer.Exec(ci)
+			s.watch.leave()
 		case cb := <-s.g.ChanCb:
+			s.watch.enter()
 			s.g.Cb(cb)
+			s.watch.leave()
 		case t := <-s.dispatcher.ChanTimer:
+			s.watch.enter()
 			t.Cb()
+			s.watch.leave()
 		}
 	}
 }
 
+// a Skeleton initialized again may monitor a new server under the name
+func (s *Skeleton) unmonitor() {
+	if s.monitored {
+		chanrpc.Unmonitor(s.Name)
+		s.monitored = false
+	}
+}
+
 func (s *Skeleton) AfterFunc(d time.Duration, cb func()) *timer.Timer {
 	if s.TimerDispatcherLen == 0 {
 		panic("invalid TimerDispatcherLen")
@@ -75,6 +146,10 @@ func (s *Skeleton) AfterFunc(d time.Duration, cb func()) *timer.Timer {
 	return s.dispatcher.AfterFunc(d, cb)
 }
 
+func (s *Skeleton) Now() time.Time {
+	return s.Clock.Now()
+}
+
 func (s *Skeleton) CronFunc(cronExpr *timer.CronExpr, cb func()) *timer.Cron {
 	if s.TimerDispatcherLen == 0 {
 		panic("invalid TimerDispatcherLen")
@@ -83,6 +158,23 @@ func (s *Skeleton) CronFunc(cronExpr *timer.CronExpr, cb func()) *timer.Cron {
 	return s.dispatcher.CronFunc(cronExpr, cb)
 }
 
+func (s *Skeleton) TickerFunc(d time.Duration, jitter time.Duration, cb func()) *timer.Ticker {
+	if s.TimerDispatcherLen == 0 {
+		panic("invalid TimerDispatcherLen")
+	}
+
+	return s.dispatcher.TickerFunc(d, jitter, cb)
+}
+
+// timers of an entity, stopped, paused or resumed at once
+func (s *Skeleton) NewTimerGroup() *timer.Group {
+	if s.TimerDispatcherLen == 0 {
+		panic("invalid TimerDispatcherLen")
+	}
+
+	return s.dispatcher.NewGroup()
+}
+
 func (s *Skeleton) Go(f func(), cb func()) {
 	if s.GoLen == 0 {
 		panic("invalid GoLen")
@@ -99,6 +191,14 @@ func (s *Skeleton) NewLinearContext() *g.LinearContext {
 	return s.g.NewLinearContext()
 }
 
+func (s *Skeleton) NewKeyedContext() *g.KeyedContext {
+	if s.GoLen == 0 {
+		panic("invalid GoLen")
+	}
+
+	return s.g.NewKeyedContext()
+}
+
 func (s *Skeleton) AsynCall(server *chanrpc.Server, id interface{}, args ...interface{}) {
 	if s.AsynCallLen == 0 {
 		panic("invalid AsynCallLen")
@@ -108,6 +208,29 @@ func (s *Skeleton) AsynCall(server *chanrpc.Server, id interface{}, args ...inte
 	s.client.AsynCall(id, args...)
 }
 
+func (s *Skeleton) AsynCallContext(ctx context.Context, server *chanrpc.Server, id interface{}, args ...interface{}) {
+	if s.AsynCallLen == 0 {
+		panic("invalid AsynCallLen")
+	}
+
+	s.client.Attach(server)
+	s.client.AsynCallContext(ctx, id, args...)
+}
+
+// the handler is called on the goroutine of the skeleton
+func (s *Skeleton) Subscribe(topic string, h func(ev interface{})) *event.Subscription {
+	return s.events.Subscribe(topic, h)
+}
+
+func (s *Skeleton) Publish(topic string, ev interface{}) {
+	s.events.Publish(topic, ev)
+}
+
+// for typed events, e.g. event.Subscribe(s.Events(), topic, h)
+func (s *Skeleton) Events() *event.Dispatcher {
+	return s.events
+}
+
 func (s *Skeleton) RegisterChanRPC(id interface{}, f interface{}) {
 	if s.ChanRPCServer == nil {
 		panic("invalid ChanRPCServer")
@@ -117,5 +240,33 @@ func (s *Skeleton) RegisterChanRPC(id interface{}, f interface{}) {
 }
 
 func (s *Skeleton) RegisterCommand(name string, help string, f interface{}) {
+	if s.Console != nil {
+		s.Console.Register(name, help, f, s.commandServer)
+		return
+	}
 	console.Register(name, help, f, s.commandServer)
 }
+
+func AsynCall[Req, Resp any](s *Skeleton, fn chanrpc.Func[Req, Resp], req Req, cb func(Resp, error)) {
+	if s.AsynCallLen == 0 {
+		panic("invalid AsynCallLen")
+	}
+
+	chanrpc.AsynCall(s.client, fn, req, cb)
+}
+
+func AsynCallContext[Req, Resp any](ctx context.Context, s *Skeleton, fn chanrpc.Func[Req, Resp], req Req, cb func(Resp, error)) {
+	if s.AsynCallLen == 0 {
+		panic("invalid AsynCallLen")
+	}
+
+	chanrpc.AsynCallContext(ctx, s.client, fn, req, cb)
+}
+
+func RegisterChanRPC[Req, Resp any](s *Skeleton, id interface{}, f func(Req) Resp) chanrpc.Func[Req, Resp] {
+	if s.ChanRPCServer == nil {
+		panic("invalid ChanRPCServer")
+	}
+
+	return chanrpc.Register(s.server, id, f)
+}
@@ -0,0 +1,158 @@
+package module
+
+import (
+	"fmt"
+	"github.com/qumi/matrix/conf"
+	"github.com/qumi/matrix/log"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+type Restart int
+
+const (
+	RestartNever Restart = iota
+	RestartAlways
+)
+
+type RestartPolicy struct {
+	Restart Restart
+	// restarts allowed within Window, 0 is unlimited
+	MaxRestarts int
+	// 0 counts all restarts
+	Window time.Duration
+	// delay before a restart, doubled by each restart within Window
+	// up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// optionally implemented by modules, DefaultRestartPolicy otherwise
+type Supervised interface {
+	RestartPolicy() RestartPolicy
+}
+
+// a module panicking in Run is not restarted by default, the failure is
+// escalated so the process shuts down instead of running without it
+var DefaultRestartPolicy = RestartPolicy{Restart: RestartNever}
+
+// receives an error when a module exceeds its restart policy, the process
+// should shut down
+func Escalation() <-chan error {
+	return Default.Escalation()
+}
+
+func (mgr *Manager) Escalation() <-chan error {
+	return mgr.escalation
+}
+
+func (mgr *Manager) escalate(err error) {
+	select {
+	case mgr.escalation <- err:
+	default:
+	}
+}
+
+// restarts within the window, nil when no more restart is allowed
+func (p *RestartPolicy) allow(restarts []time.Time, now time.Time) []time.Time {
+	if p.Restart == RestartNever {
+		return nil
+	}
+
+	if p.Window > 0 {
+		i := 0
+		for i < len(restarts) && now.Sub(restarts[i]) > p.Window {
+			i++
+		}
+		restarts = restarts[i:]
+	}
+	if p.MaxRestarts > 0 && len(restarts) >= p.MaxRestarts {
+		return nil
+	}
+
+	return append(restarts, now)
+}
+
+func (p *RestartPolicy) backoff(restarts int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < restarts && d > 0; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return d
+}
+
+func runOnce(m *module) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if conf.LenStackBuf > 0 {
+				buf := make([]byte, conf.LenStackBuf)
+				l := runtime.Stack(buf, false)
+				log.Error("%v: %s", r, buf[:l])
+			} else {
+				log.Error("%v", r)
+			}
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	m.mi.Run(m.closeSig)
+	return nil
+}
+
+// runs the module until it returns, restarting it on panics per its policy
+func supervise(m *module) {
+	var restarts []time.Time
+
+	for {
+		err := runOnce(m)
+		if err == nil {
+			// returned before Destroy
+			atomic.CompareAndSwapInt32(&m.state, int32(StateRunning), int32(StateStopped))
+			return
+		}
+		log.Error("module %v Run: %v", m.name, err)
+
+		for {
+			restarts = m.policy.allow(restarts, m.mgr.clock().Now())
+			if restarts == nil {
+				m.setState(StateFailed)
+				m.mgr.escalate(fmt.Errorf("module %v failed: %v", m.name, err))
+				return
+			}
+
+			m.setState(StateRestarting)
+			if m.inited {
+				destroy(m)
+				m.inited = false
+			}
+
+			backoff := make(chan bool, 1)
+			t := m.mgr.clock().AfterFunc(m.policy.backoff(len(restarts)), func() {
+				backoff <- true
+			})
+			select {
+			case <-backoff:
+			case <-m.closeSig:
+				t.Stop()
+				return
+			}
+
+			log.Release("module %v restarting (%v)", m.name, len(restarts))
+			err = initialize(m)
+			if err == nil {
+				break
+			}
+			log.Error("module %v OnInit: %v", m.name, err)
+		}
+
+		m.inited = true
+		m.setState(StateRunning)
+	}
+}
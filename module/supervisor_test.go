@@ -0,0 +1,91 @@
+package module_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/qumi/matrix/clock"
+	"github.com/qumi/matrix/module"
+)
+
+type crashing struct {
+	policy module.RestartPolicy
+	runs   chan int
+	n      int
+}
+
+func (m *crashing) OnInit()    {}
+func (m *crashing) OnDestroy() {}
+
+func (m *crashing) RestartPolicy() module.RestartPolicy {
+	return m.policy
+}
+
+func (m *crashing) Run(closeSig chan bool) {
+	m.n++
+	m.runs <- m.n
+	if m.n == 1 {
+		panic("crash")
+	}
+	<-closeSig
+}
+
+func TestRestartNeverEscalates(t *testing.T) {
+	mgr := module.NewManager()
+	m := &crashing{runs: make(chan int, 2)}
+	m.policy = module.DefaultRestartPolicy
+	mgr.Register(m)
+	if err := mgr.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Destroy()
+
+	select {
+	case err := <-mgr.Escalation():
+		if err == nil {
+			t.Fatal("nil escalation")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("panic not escalated")
+	}
+	if s, _ := mgr.StateOf("*module_test.crashing"); s != module.StateFailed {
+		t.Fatalf("state %v, want failed", s)
+	}
+}
+
+func TestRestartBackoffClock(t *testing.T) {
+	c := clock.NewFake(time.Unix(0, 0))
+	mgr := module.NewManager()
+	mgr.Clock = c
+	m := &crashing{runs: make(chan int, 2)}
+	m.policy = module.RestartPolicy{Restart: module.RestartAlways, Backoff: time.Hour}
+	mgr.Register(m)
+	if err := mgr.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Destroy()
+
+	<-m.runs
+	// restarted once the fake clock passes the backoff
+	for i := 0; i < 500; i++ {
+		if s, _ := mgr.StateOf("*module_test.crashing"); s == module.StateRestarting {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-m.runs:
+		t.Fatal("restarted before the backoff")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	c.Advance(time.Hour)
+	select {
+	case n := <-m.runs:
+		if n != 2 {
+			t.Fatalf("run %v, want 2", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("not restarted")
+	}
+}
@@ -0,0 +1,275 @@
+package module
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/qumi/matrix/conf"
+	"github.com/qumi/matrix/console"
+	"github.com/qumi/matrix/log"
+	"github.com/qumi/matrix/util"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Health struct {
+	Name string
+	// running time of the current handler
+	Busy time.Duration
+	// max running time of handlers in the last watchdog interval
+	MaxLatency time.Duration
+	Healthy    bool
+}
+
+// loop latency of a skeleton
+type watch struct {
+	name       string
+	goid       int64
+	busySince  int64
+	maxLatency int64
+	lastMax    int64
+	stuck      bool
+}
+
+var watchdog struct {
+	sync.Mutex
+	watches  []*watch
+	seq      int
+	managers []*Manager
+	closeSig chan bool
+	server   *http.Server
+}
+
+func init() {
+	console.RegisterFunc("health", "health of skeletons", healthCommand)
+}
+
+// nil when the watchdog is disabled
+func newWatch(name string) *watch {
+	if conf.WatchdogThreshold <= 0 {
+		return nil
+	}
+
+	w := &watch{name: name}
+
+	watchdog.Lock()
+	if w.name == "" {
+		w.name = fmt.Sprintf("skeleton-%d", watchdog.seq)
+	}
+	watchdog.seq++
+	watchdog.watches = append(watchdog.watches, w)
+	watchdog.Unlock()
+
+	return w
+}
+
+// called on the goroutine of the skeleton
+func (w *watch) start() {
+	if w == nil {
+		return
+	}
+	atomic.StoreInt64(&w.goid, util.GoroutineID())
+}
+
+// no longer reported
+func (w *watch) close() {
+	if w == nil {
+		return
+	}
+
+	watchdog.Lock()
+	defer watchdog.Unlock()
+	for i, _w := range watchdog.watches {
+		if _w == w {
+			watchdog.watches = append(watchdog.watches[:i:i], watchdog.watches[i+1:]...)
+			break
+		}
+	}
+}
+
+func (w *watch) enter() {
+	if w == nil {
+		return
+	}
+	atomic.StoreInt64(&w.busySince, time.Now().UnixNano())
+}
+
+func (w *watch) leave() {
+	if w == nil {
+		return
+	}
+	d := time.Now().UnixNano() - atomic.SwapInt64(&w.busySince, 0)
+	if d > atomic.LoadInt64(&w.maxLatency) {
+		atomic.StoreInt64(&w.maxLatency, d)
+	}
+}
+
+func (w *watch) busy(now time.Time) time.Duration {
+	since := atomic.LoadInt64(&w.busySince)
+	if since == 0 {
+		return 0
+	}
+	return now.Sub(time.Unix(0, since))
+}
+
+func (w *watch) health(now time.Time) Health {
+	h := Health{
+		Name:       w.name,
+		Busy:       w.busy(now),
+		MaxLatency: time.Duration(atomic.LoadInt64(&w.lastMax)),
+	}
+	h.Healthy = conf.WatchdogThreshold <= 0 || h.Busy < conf.WatchdogThreshold
+	return h
+}
+
+// called on the watchdog goroutine
+func (w *watch) check(now time.Time) {
+	atomic.StoreInt64(&w.lastMax, atomic.SwapInt64(&w.maxLatency, 0))
+
+	busy := w.busy(now)
+	if busy < conf.WatchdogThreshold {
+		w.stuck = false
+		return
+	}
+	if w.stuck {
+		return
+	}
+
+	w.stuck = true
+	log.Error("skeleton %v stuck in a handler for %v: %s",
+		w.name, busy, util.GoroutineStack(atomic.LoadInt64(&w.goid)))
+}
+
+// goroutine safe
+func HealthOf() []Health {
+	watchdog.Lock()
+	defer watchdog.Unlock()
+
+	now := time.Now()
+	hs := make([]Health, len(watchdog.watches))
+	for i, w := range watchdog.watches {
+		hs[i] = w.health(now)
+	}
+	return hs
+}
+
+// infos of the managers initialized
+func runningInfos() []Info {
+	watchdog.Lock()
+	managers := watchdog.managers
+	watchdog.Unlock()
+
+	var infos []Info
+	for _, mgr := range managers {
+		infos = append(infos, mgr.Infos()...)
+	}
+	return infos
+}
+
+// shared by the managers, running while any is initialized
+func startWatchdog(mgr *Manager) {
+	watchdog.Lock()
+	defer watchdog.Unlock()
+
+	watchdog.managers = append(watchdog.managers, mgr)
+	if len(watchdog.managers) > 1 {
+		return
+	}
+
+	if conf.WatchdogThreshold > 0 && conf.WatchdogInterval > 0 {
+		watchdog.closeSig = make(chan bool)
+		go runWatchdog(watchdog.closeSig)
+	}
+
+	if conf.HealthAddr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/health", healthHandler)
+		watchdog.server = &http.Server{Addr: conf.HealthAddr, Handler: mux}
+		go func(server *http.Server) {
+			err := server.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				log.Error("health check endpoint: %v", err)
+			}
+		}(watchdog.server)
+	}
+}
+
+func stopWatchdog(mgr *Manager) {
+	watchdog.Lock()
+	defer watchdog.Unlock()
+
+	for i, _mgr := range watchdog.managers {
+		if _mgr == mgr {
+			watchdog.managers = append(watchdog.managers[:i:i], watchdog.managers[i+1:]...)
+			break
+		}
+	}
+	if len(watchdog.managers) > 0 {
+		return
+	}
+
+	if watchdog.closeSig != nil {
+		close(watchdog.closeSig)
+		watchdog.closeSig = nil
+	}
+	if watchdog.server != nil {
+		watchdog.server.Close()
+		watchdog.server = nil
+	}
+}
+
+func runWatchdog(closeSig chan bool) {
+	ticker := time.NewTicker(conf.WatchdogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closeSig:
+			return
+		case now := <-ticker.C:
+			watchdog.Lock()
+			for _, w := range watchdog.watches {
+				w.check(now)
+			}
+			watchdog.Unlock()
+		}
+	}
+}
+
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	hs := HealthOf()
+	infos := runningInfos()
+
+	status := http.StatusOK
+	for _, h := range hs {
+		if !h.Healthy {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	for _, info := range infos {
+		if info.State == StateFailed {
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Modules   []Info
+		Skeletons []Health
+	}{infos, hs})
+}
+
+func healthCommand(args []string) string {
+	output := fmt.Sprintf("%-16v %-12v %v", "Module", "State", "DependsOn")
+	for _, info := range runningInfos() {
+		output += fmt.Sprintf("\r\n%-16v %-12v %v", info.Name, info.State, info.DependsOn)
+	}
+
+	output += fmt.Sprintf("\r\n\r\n%-16v %8v %12v %12v", "Skeleton", "Healthy", "Busy", "MaxLatency")
+	for _, h := range HealthOf() {
+		output += fmt.Sprintf("\r\n%-16v %8v %12v %12v", h.Name, h.Healthy, h.Busy, h.MaxLatency)
+	}
+	return output
+}
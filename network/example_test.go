@@ -0,0 +1,46 @@
+package network_test
+
+import (
+	"fmt"
+	"github.com/qumi/matrix/network"
+	"github.com/qumi/matrix/network/json"
+)
+
+func ExampleParseHandshake() {
+	h := &network.Handshake{Version: 2, Codec: "json"}
+	data := h.Marshal(true)
+	fmt.Println(data)
+
+	h, err := network.ParseHandshake(data, true)
+	fmt.Println(h, err)
+
+	// truncated
+	_, err = network.ParseHandshake(data[:1], true)
+	fmt.Println(err)
+
+	// Output:
+	// [2 0 106 115 111 110]
+	// json/2 <nil>
+	// handshake data too short
+}
+
+func ExampleProcessorSet() {
+	s := network.NewProcessorSet()
+	s.Register(1, "json", json.NewProcessor())
+
+	_, err := s.Select(&network.Handshake{Version: 1, Codec: "json"})
+	fmt.Println(err)
+
+	// unknown version
+	_, err = s.Select(&network.Handshake{Version: 2, Codec: "json"})
+	fmt.Println(err)
+
+	s.Unregister(1, "json")
+	_, err = s.Select(&network.Handshake{Version: 1, Codec: "json"})
+	fmt.Println(err)
+
+	// Output:
+	// <nil>
+	// protocol json/2 not supported
+	// protocol json/1 not supported
+}
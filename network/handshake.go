@@ -0,0 +1,91 @@
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const lenVersion = 2
+
+// handshake sent by the client as the first message after connecting,
+// echoed back by the server when accepted
+// ---------------------
+// | version | codec   |
+// ---------------------
+type Handshake struct {
+	Version uint16
+	Codec   string
+}
+
+func ParseHandshake(data []byte, littleEndian bool) (*Handshake, error) {
+	if len(data) < lenVersion {
+		return nil, errors.New("handshake data too short")
+	}
+
+	h := new(Handshake)
+	if littleEndian {
+		h.Version = binary.LittleEndian.Uint16(data)
+	} else {
+		h.Version = binary.BigEndian.Uint16(data)
+	}
+	h.Codec = string(data[lenVersion:])
+	return h, nil
+}
+
+func (h *Handshake) Marshal(littleEndian bool) []byte {
+	data := make([]byte, lenVersion+len(h.Codec))
+	if littleEndian {
+		binary.LittleEndian.PutUint16(data, h.Version)
+	} else {
+		binary.BigEndian.PutUint16(data, h.Version)
+	}
+	copy(data[lenVersion:], h.Codec)
+	return data
+}
+
+func (h *Handshake) String() string {
+	return fmt.Sprintf("%v/%v", h.Codec, h.Version)
+}
+
+// processors registered side by side, selected per connection by handshake
+type ProcessorSet struct {
+	sync.RWMutex
+	processors map[Handshake]Processor
+}
+
+func NewProcessorSet() *ProcessorSet {
+	s := new(ProcessorSet)
+	s.processors = make(map[Handshake]Processor)
+	return s
+}
+
+// goroutine safe
+func (s *ProcessorSet) Register(version uint16, codec string, p Processor) {
+	if p == nil {
+		panic("processor must not be nil")
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.processors[Handshake{Version: version, Codec: codec}] = p
+}
+
+// goroutine safe
+func (s *ProcessorSet) Unregister(version uint16, codec string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.processors, Handshake{Version: version, Codec: codec})
+}
+
+// goroutine safe
+func (s *ProcessorSet) Select(h *Handshake) (Processor, error) {
+	s.RLock()
+	defer s.RUnlock()
+	p, ok := s.processors[*h]
+	if !ok {
+		return nil, fmt.Errorf("protocol %v not supported", h)
+	}
+	return p, nil
+}
@@ -0,0 +1,57 @@
+package json_test
+
+import (
+	"fmt"
+	"github.com/qumi/matrix/network/json"
+)
+
+type Hello struct {
+	Name string
+}
+
+type agent struct {
+	id int
+}
+
+func ExampleRegisterHandler() {
+	p := json.NewProcessor()
+
+	json.RegisterHandler(p, func(msg *Hello, a *agent) {
+		fmt.Println(msg.Name, a.id)
+	})
+
+	msg, err := p.Unmarshal([]byte(`{"Hello":{"Name":"matrix"}}`))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	p.Route(msg, &agent{id: 1})
+
+	// Output:
+	// matrix 1
+}
+
+type SetName struct {
+	Name  string `validate:"required,max=8"`
+	Color string `validate:"oneof=red green blue"`
+}
+
+func ExampleProcessor_SetValidation() {
+	p := json.NewProcessor()
+	p.Register(&SetName{})
+	p.SetValidation(true, false)
+
+	_, err := p.Unmarshal([]byte(`{"SetName":{"Name":"matrix","Color":"red"}}`))
+	fmt.Println(err)
+	_, err = p.Unmarshal([]byte(`{"SetName":{"Name":"","Color":"red"}}`))
+	fmt.Println(err)
+	_, err = p.Unmarshal([]byte(`{"SetName":{"Name":"matrix","Color":"pink"}}`))
+	fmt.Println(err)
+	fmt.Println(p.Violations("SetName"))
+
+	// Output:
+	// <nil>
+	// message SetName invalid: Name is required
+	// message SetName invalid: Color must be one of red green blue
+	// 2
+}
@@ -6,15 +6,21 @@ import (
 	"fmt"
 	"github.com/qumi/matrix/chanrpc"
 	"github.com/qumi/matrix/log"
+	"github.com/qumi/matrix/network"
 	"reflect"
+	"sync/atomic"
 )
 
 type Processor struct {
-	msgInfo map[string]*MsgInfo
+	msgInfo    map[string]*MsgInfo
+	validate   bool
+	disconnect bool
 }
 
 type MsgInfo struct {
+	violations    uint64
 	msgType       reflect.Type
+	rules         []*fieldRule
 	msgRouter     *chanrpc.Server
 	msgHandler    MsgHandler
 	msgRawHandler MsgHandler
@@ -49,10 +55,35 @@ func (p *Processor) Register(msg interface{}) string {
 
 	i := new(MsgInfo)
 	i.msgType = msgType
+	if msgType.Elem().Kind() == reflect.Struct {
+		rules, err := parseRules(msgType.Elem(), make(map[reflect.Type]bool))
+		if err != nil {
+			log.Fatal("message %v: %v", msgID, err)
+		}
+		i.rules = rules
+	}
 	p.msgInfo[msgID] = i
 	return msgID
 }
 
+// validate messages by struct tags and the network.Validator interface
+// in Unmarshal, a violation is returned as *network.ValidationError
+//
+// It's dangerous to call the method on routing or marshaling (unmarshaling)
+func (p *Processor) SetValidation(validate bool, disconnect bool) {
+	p.validate = validate
+	p.disconnect = disconnect
+}
+
+// goroutine safe
+func (p *Processor) Violations(msgID string) uint64 {
+	i, ok := p.msgInfo[msgID]
+	if !ok {
+		return 0
+	}
+	return atomic.LoadUint64(&i.violations)
+}
+
 // It's dangerous to call the method on routing or marshaling (unmarshaling)
 func (p *Processor) SetRouter(msg interface{}, msgRouter *chanrpc.Server) {
 	msgType := reflect.TypeOf(msg)
@@ -148,13 +179,32 @@ func (p *Processor) Unmarshal(data []byte) (interface{}, error) {
 			return MsgRaw{msgID, data}, nil
 		} else {
 			msg := reflect.New(i.msgType.Elem()).Interface()
-			return msg, json.Unmarshal(data, msg)
+			err := json.Unmarshal(data, msg)
+			if err == nil && p.validate {
+				err = p.check(msgID, i, msg)
+			}
+			return msg, err
 		}
 	}
 
 	panic("bug")
 }
 
+func (p *Processor) check(msgID string, i *MsgInfo, msg interface{}) error {
+	err := validate(reflect.ValueOf(msg).Elem(), i.rules)
+	if err == nil {
+		if v, ok := msg.(network.Validator); ok {
+			err = v.Validate()
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	atomic.AddUint64(&i.violations, 1)
+	return &network.ValidationError{MsgID: msgID, Err: err, Disconnect: p.disconnect}
+}
+
 // goroutine safe
 func (p *Processor) Marshal(msg interface{}) ([][]byte, error) {
 	msgType := reflect.TypeOf(msg)
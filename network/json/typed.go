@@ -0,0 +1,56 @@
+package json
+
+import (
+	"github.com/qumi/matrix/chanrpc"
+	"github.com/qumi/matrix/log"
+	"reflect"
+)
+
+// RegisterHandler registers the message type T (if it is not registered yet)
+// and sets a typed handler for it. The handler runs on the goroutine calling
+// Route, the same as handlers set by SetHandler.
+//
+// It's dangerous to call the function on routing or marshaling (unmarshaling)
+func RegisterHandler[T any, A any](p *Processor, h func(msg *T, agent A)) string {
+	msgID := p.register((*T)(nil))
+	p.SetHandler((*T)(nil), func(args []interface{}) {
+		agent, ok := args[1].(A)
+		if !ok {
+			log.Error("message %v: agent type %T mismatch", msgID, args[1])
+			return
+		}
+		h(args[0].(*T), agent)
+	})
+	return msgID
+}
+
+// RegisterRoute registers the message type T (if it is not registered yet),
+// routes it to server and registers h on server under the message type,
+// so h runs on the goroutine of server.
+//
+// you must call the function before calling Open and Go of server
+func RegisterRoute[T any, A any](p *Processor, server *chanrpc.Server, h func(msg *T, agent A)) string {
+	msgID := p.register((*T)(nil))
+	p.SetRouter((*T)(nil), server)
+	server.Register(reflect.TypeOf((*T)(nil)), func(args []interface{}) {
+		agent, ok := args[1].(A)
+		if !ok {
+			log.Error("message %v: agent type %T mismatch", msgID, args[1])
+			return
+		}
+		h(args[0].(*T), agent)
+	})
+	return msgID
+}
+
+func (p *Processor) register(msg interface{}) string {
+	msgType := reflect.TypeOf(msg)
+	msgID := msgType.Elem().Name()
+	if i, ok := p.msgInfo[msgID]; ok {
+		if i.msgType != msgType {
+			log.Fatal("message %v is already registered with type %v", msgID, i.msgType)
+		}
+		return msgID
+	}
+	return p.Register(msg)
+}
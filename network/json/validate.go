@@ -0,0 +1,218 @@
+package json
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// struct tag rules, checked in Unmarshal when validation is enabled
+//
+// Rule     | Applies to
+// -------- | -----------------------------------------------------------
+// required | any, the value must not be zero
+// min=n    | numbers (value), strings (characters), slices and maps (length)
+// max=n    | numbers (value), strings (characters), slices and maps (length)
+// len=n    | strings (characters), slices and maps (length)
+// oneof=.. | strings and numbers, space separated values
+//
+// e.g. `validate:"required,max=16"`, `validate:"oneof=red green blue"`
+const validateTag = "validate"
+
+type fieldRule struct {
+	index    int
+	name     string
+	required bool
+	min      *float64
+	max      *float64
+	len      *int
+	oneof    []string
+	nested   []*fieldRule
+}
+
+func parseRules(t reflect.Type, parsing map[reflect.Type]bool) ([]*fieldRule, error) {
+	if parsing[t] {
+		return nil, nil
+	}
+	parsing[t] = true
+	defer delete(parsing, t)
+
+	var rules []*fieldRule
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		r := &fieldRule{index: i, name: f.Name}
+		if tag := f.Tag.Get(validateTag); tag != "" {
+			err := r.parse(tag, f.Type)
+			if err != nil {
+				return nil, fmt.Errorf("field %v: %v", f.Name, err)
+			}
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct {
+			nested, err := parseRules(ft, parsing)
+			if err != nil {
+				return nil, fmt.Errorf("field %v: %v", f.Name, err)
+			}
+			r.nested = nested
+		}
+
+		if r.required || r.min != nil || r.max != nil || r.len != nil || r.oneof != nil || r.nested != nil {
+			rules = append(rules, r)
+		}
+	}
+
+	return rules, nil
+}
+
+func (r *fieldRule) parse(tag string, t reflect.Type) error {
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+
+		switch name {
+		case "required":
+			r.required = true
+		case "min", "max":
+			if !isNumber(t) && !hasLen(t) {
+				return fmt.Errorf("%v not applicable to %v", name, t)
+			}
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %v: %v", name, arg)
+			}
+			if name == "min" {
+				r.min = &n
+			} else {
+				r.max = &n
+			}
+		case "len":
+			if !hasLen(t) {
+				return fmt.Errorf("len not applicable to %v", t)
+			}
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				return fmt.Errorf("invalid len: %v", arg)
+			}
+			r.len = &n
+		case "oneof":
+			if !isNumber(t) && t.Kind() != reflect.String {
+				return fmt.Errorf("oneof not applicable to %v", t)
+			}
+			r.oneof = strings.Fields(arg)
+			if len(r.oneof) == 0 {
+				return errors.New("empty oneof")
+			}
+		default:
+			return fmt.Errorf("unknown rule %v", name)
+		}
+	}
+
+	return nil
+}
+
+func isNumber(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func hasLen(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return true
+	}
+	return false
+}
+
+func number(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
+
+func length(v reflect.Value) int {
+	if v.Kind() == reflect.String {
+		return utf8.RuneCountInString(v.String())
+	}
+	return v.Len()
+}
+
+func validate(v reflect.Value, rules []*fieldRule) error {
+	for _, r := range rules {
+		fv := v.Field(r.index)
+
+		if r.required && fv.IsZero() {
+			return fmt.Errorf("%v is required", r.name)
+		}
+
+		if r.min != nil || r.max != nil {
+			var n float64
+			if isNumber(fv.Type()) {
+				n = number(fv)
+			} else {
+				n = float64(length(fv))
+			}
+			if r.min != nil && n < *r.min {
+				return fmt.Errorf("%v less than %v", r.name, *r.min)
+			}
+			if r.max != nil && n > *r.max {
+				return fmt.Errorf("%v greater than %v", r.name, *r.max)
+			}
+		}
+
+		if r.len != nil && length(fv) != *r.len {
+			return fmt.Errorf("%v length must be %v", r.name, *r.len)
+		}
+
+		if r.oneof != nil {
+			s := fmt.Sprint(fv.Interface())
+			found := false
+			for _, o := range r.oneof {
+				if o == s {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("%v must be one of %v", r.name, strings.Join(r.oneof, " "))
+			}
+		}
+
+		if r.nested != nil {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			err := validate(fv, r.nested)
+			if err != nil {
+				return fmt.Errorf("%v.%v", r.name, err)
+			}
+		}
+	}
+
+	return nil
+}
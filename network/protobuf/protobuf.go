@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"sync/atomic"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/qumi/matrix/chanrpc"
 	"github.com/qumi/matrix/log"
+	"github.com/qumi/matrix/network"
 )
 
 // -------------------------
@@ -19,9 +21,12 @@ type Processor struct {
 	littleEndian bool
 	msgInfoMap   map[uint32]*MsgInfo
 	msgID        map[reflect.Type]uint32
+	validate     bool
+	disconnect   bool
 }
 
 type MsgInfo struct {
+	violations    uint64
 	msgType       reflect.Type
 	msgRouter     *chanrpc.Server
 	msgHandler    MsgHandler
@@ -49,6 +54,24 @@ func (p *Processor) SetByteOrder(littleEndian bool) {
 	p.littleEndian = littleEndian
 }
 
+// validate messages implementing network.Validator in Unmarshal,
+// a violation is returned as *network.ValidationError
+//
+// It's dangerous to call the method on routing or marshaling (unmarshaling)
+func (p *Processor) SetValidation(validate bool, disconnect bool) {
+	p.validate = validate
+	p.disconnect = disconnect
+}
+
+// goroutine safe
+func (p *Processor) Violations(id uint32) uint64 {
+	i, ok := p.msgInfoMap[id]
+	if !ok {
+		return 0
+	}
+	return atomic.LoadUint64(&i.violations)
+}
+
 // It's dangerous to call the method on routing or marshaling (unmarshaling)
 func (p *Processor) Register(msg proto.Message, msgId uint32) {
 	msgType := reflect.TypeOf(msg)
@@ -162,10 +185,28 @@ func (p *Processor) Unmarshal(data []byte) (interface{}, error) {
 		return MsgRaw{id, data[4:]}, nil
 	} else {
 		msg := reflect.New(i.msgType.Elem()).Interface()
-		return msg, proto.UnmarshalMerge(data[4:], msg.(proto.Message))
+		err := proto.UnmarshalMerge(data[4:], msg.(proto.Message))
+		if err == nil && p.validate {
+			err = p.check(id, i, msg)
+		}
+		return msg, err
 	}
 }
 
+func (p *Processor) check(id uint32, i *MsgInfo, msg interface{}) error {
+	v, ok := msg.(network.Validator)
+	if !ok {
+		return nil
+	}
+	err := v.Validate()
+	if err == nil {
+		return nil
+	}
+
+	atomic.AddUint64(&i.violations, 1)
+	return &network.ValidationError{MsgID: id, Err: err, Disconnect: p.disconnect}
+}
+
 // goroutine safe
 func (p *Processor) Marshal(msg interface{}) ([][]byte, error) {
 	msgType := reflect.TypeOf(msg)
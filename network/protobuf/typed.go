@@ -0,0 +1,63 @@
+package protobuf
+
+import (
+	"reflect"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/qumi/matrix/chanrpc"
+	"github.com/qumi/matrix/log"
+)
+
+// RegisterHandler registers the message type PT with msgId (if it is not
+// registered yet) and sets a typed handler for it. The handler runs on the
+// goroutine calling Route, the same as handlers set by SetHandler.
+//
+// It's dangerous to call the function on routing or marshaling (unmarshaling)
+func RegisterHandler[T any, PT interface {
+	*T
+	proto.Message
+}, A any](p *Processor, msgId uint32, h func(msg PT, agent A)) {
+	var msg PT = new(T)
+	p.register(msg, msgId)
+	p.SetHandler(msg, func(args []interface{}) {
+		agent, ok := args[1].(A)
+		if !ok {
+			log.Error("message %s: agent type %T mismatch", reflect.TypeOf(msg), args[1])
+			return
+		}
+		h(args[0].(PT), agent)
+	})
+}
+
+// RegisterRoute registers the message type PT with msgId (if it is not
+// registered yet), routes it to server and registers h on server under the
+// message type, so h runs on the goroutine of server.
+//
+// you must call the function before calling Open and Go of server
+func RegisterRoute[T any, PT interface {
+	*T
+	proto.Message
+}, A any](p *Processor, msgId uint32, server *chanrpc.Server, h func(msg PT, agent A)) {
+	var msg PT = new(T)
+	p.register(msg, msgId)
+	p.SetRouter(msg, server)
+	server.Register(reflect.TypeOf(msg), func(args []interface{}) {
+		agent, ok := args[1].(A)
+		if !ok {
+			log.Error("message %s: agent type %T mismatch", reflect.TypeOf(msg), args[1])
+			return
+		}
+		h(args[0].(PT), agent)
+	})
+}
+
+func (p *Processor) register(msg proto.Message, msgId uint32) {
+	msgType := reflect.TypeOf(msg)
+	if id, ok := p.msgID[msgType]; ok {
+		if id != msgId {
+			log.Fatal("message %s is already registered with msgId:%d", msgType, id)
+		}
+		return
+	}
+	p.Register(msg, msgId)
+}
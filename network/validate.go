@@ -0,0 +1,29 @@
+package network
+
+import (
+	"fmt"
+)
+
+// implemented by messages validating themselves after unmarshaling
+type Validator interface {
+	Validate() error
+}
+
+// returned by Processor.Unmarshal when a message fails validation
+type ValidationError struct {
+	MsgID      interface{}
+	Err        error
+	Disconnect bool
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("message %v invalid: %v", e.MsgID, e.Err)
+}
+
+// whether the connection should be closed for the unmarshal error
+func Disconnect(err error) bool {
+	if e, ok := err.(*ValidationError); ok {
+		return e.Disconnect
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package schedule_test
+
+import (
+	"fmt"
+	"github.com/qumi/matrix/clock"
+	"github.com/qumi/matrix/schedule"
+	"github.com/qumi/matrix/timer"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func Example() {
+	dir, err := os.MkdirTemp("", "schedule")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+	store := schedule.NewFileStore(filepath.Join(dir, "jobs.json"))
+
+	// missed while down
+	store.Save(&schedule.Job{
+		ID:   "end season",
+		Name: "season",
+		Data: []byte("S1"),
+		At:   time.Now().Add(-time.Hour),
+	})
+	store.Save(&schedule.Job{
+		ID:      "daily reward",
+		Name:    "reward",
+		At:      time.Now().Add(-time.Hour),
+		Cron:    "@daily",
+		Catchup: schedule.CatchupSkip,
+	})
+
+	d := timer.NewDispatcher(10)
+	s := schedule.New(store, d)
+	s.Handle("season", func(job *schedule.Job) error {
+		fmt.Printf("end season %s\n", job.Data)
+		return nil
+	})
+	s.Handle("reward", func(job *schedule.Job) error {
+		fmt.Println("reward")
+		return nil
+	})
+	s.Start()
+
+	// dispatch
+	(<-d.ChanTimer).Cb()
+
+	jobs, _ := store.Load()
+	for _, job := range jobs {
+		fmt.Println(job.ID, job.At.After(time.Now()))
+	}
+
+	err = s.Add(&schedule.Job{ID: "daily reward", Name: "reward", Cron: "@daily"})
+	fmt.Println(err)
+
+	// Output:
+	// end season S1
+	// daily reward true
+	// job already exists
+}
+
+func ExampleScheduler_Start() {
+	dir, err := os.MkdirTemp("", "schedule")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+	store := schedule.NewFileStore(filepath.Join(dir, "jobs.json"))
+
+	// the jobs run on the clock of the timers
+	c := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	d := timer.NewDispatcherClock(10, c)
+	s := schedule.New(store, d)
+	s.Handle("reward", func(job *schedule.Job) error {
+		fmt.Println("reward", c.Now().Format("01-02 15:04"))
+		return nil
+	})
+	s.Add(&schedule.Job{ID: "daily reward", Name: "reward", Cron: "@daily"})
+	fmt.Println(s.Start())
+	fmt.Println(s.Start())
+
+	c.Advance(24 * time.Hour)
+	(<-d.ChanTimer).Cb()
+	fmt.Println(len(d.ChanTimer))
+
+	// Output:
+	// <nil>
+	// scheduler already started
+	// reward 01-02 00:00
+	// 0
+}
@@ -0,0 +1,131 @@
+package schedule
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// jobs in a JSON file, rewritten on each change
+//
+// goroutine safe
+type FileStore struct {
+	mutex    sync.Mutex
+	filename string
+	jobs     map[string]*Job
+}
+
+func NewFileStore(filename string) *FileStore {
+	return &FileStore{filename: filename}
+}
+
+func (fs *FileStore) load() error {
+	if fs.jobs != nil {
+		return nil
+	}
+
+	jobs := make(map[string]*Job)
+	data, err := os.ReadFile(fs.filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(data) > 0 {
+		var list []*Job
+		err = json.Unmarshal(data, &list)
+		if err != nil {
+			return err
+		}
+		for _, job := range list {
+			jobs[job.ID] = job
+		}
+	}
+
+	fs.jobs = jobs
+	return nil
+}
+
+// the file is replaced by a rename, so a crash leaves the old jobs
+func (fs *FileStore) flush() error {
+	list := make([]*Job, 0, len(fs.jobs))
+	for _, job := range fs.jobs {
+		list = append(list, job)
+	}
+	data, err := json.MarshalIndent(list, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	tmp := fs.filename + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, fs.filename)
+}
+
+func (fs *FileStore) Save(job *Job) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	err := fs.load()
+	if err != nil {
+		return err
+	}
+	old := fs.jobs[job.ID]
+	fs.jobs[job.ID] = copyJob(job)
+	err = fs.flush()
+	if err != nil {
+		if old != nil {
+			fs.jobs[job.ID] = old
+		} else {
+			delete(fs.jobs, job.ID)
+		}
+	}
+	return err
+}
+
+func (fs *FileStore) Delete(id string) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	err := fs.load()
+	if err != nil {
+		return err
+	}
+	old, ok := fs.jobs[id]
+	if !ok {
+		return nil
+	}
+	delete(fs.jobs, id)
+	err = fs.flush()
+	if err != nil {
+		fs.jobs[id] = old
+	}
+	return err
+}
+
+func (fs *FileStore) Load() ([]*Job, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*Job, 0, len(fs.jobs))
+	for _, job := range fs.jobs {
+		jobs = append(jobs, copyJob(job))
+	}
+	return jobs, nil
+}
@@ -0,0 +1,290 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/qumi/matrix/conf"
+	"github.com/qumi/matrix/log"
+	"github.com/qumi/matrix/timer"
+)
+
+var (
+	ErrExist    = errors.New("job already exists")
+	ErrNotExist = errors.New("job does not exist")
+)
+
+// what to do with runs missed while the scheduler was down
+type Catchup int
+
+const (
+	// run once for the missed runs
+	CatchupOnce Catchup = iota
+	// run every missed run of a recurring job
+	CatchupAll
+	// drop the missed runs, one-off jobs are removed
+	CatchupSkip
+)
+
+type Job struct {
+	// unique
+	ID string
+	// the handler
+	Name string
+	Data []byte
+	// the next run
+	At time.Time
+	// recurring when not empty, see timer.CronExpr
+	Cron    string
+	Catchup Catchup
+}
+
+// goroutine safe
+type Store interface {
+	// inserts or replaces the job of the id
+	Save(job *Job) error
+	Delete(id string) error
+	Load() ([]*Job, error)
+}
+
+// module.Skeleton or timer.Dispatcher, the jobs run on the clock of the
+// timers
+type Timers interface {
+	AfterFunc(d time.Duration, cb func()) *timer.Timer
+	Now() time.Time
+}
+
+// runs jobs through the timers at least once, a job failing or crashing
+// before the store is updated is retried
+//
+// one scheduler per goroutine of the timers (goroutine not safe)
+type Scheduler struct {
+	// delay of a retry after a handler error or panic
+	RetryInterval time.Duration
+
+	store    Store
+	timers   Timers
+	handlers map[string]func(job *Job) error
+	jobs     map[string]*entry
+	started  bool
+}
+
+type entry struct {
+	job  *Job
+	expr *timer.CronExpr
+	t    *timer.Timer
+}
+
+func New(store Store, timers Timers) *Scheduler {
+	s := new(Scheduler)
+	s.RetryInterval = time.Minute
+	s.store = store
+	s.timers = timers
+	s.handlers = make(map[string]func(job *Job) error)
+	s.jobs = make(map[string]*entry)
+	return s
+}
+
+// you must call the function before calling Start
+func (s *Scheduler) Handle(name string, h func(job *Job) error) {
+	if _, ok := s.handlers[name]; ok {
+		panic(fmt.Sprintf("job handler %v: already registered", name))
+	}
+	s.handlers[name] = h
+}
+
+// loads the stored jobs, missed runs are caught up per job. jobs added
+// before are kept
+func (s *Scheduler) Start() error {
+	if s.started {
+		return errors.New("scheduler already started")
+	}
+	jobs, err := s.store.Load()
+	if err != nil {
+		return err
+	}
+	s.started = true
+
+	now := s.timers.Now()
+	for _, job := range jobs {
+		if _, ok := s.jobs[job.ID]; ok {
+			continue
+		}
+		e, err := newEntry(job)
+		if err != nil {
+			log.Error("job %v: %v", job.ID, err)
+			continue
+		}
+
+		if job.Catchup == CatchupSkip && job.At.Before(now) {
+			if e.expr == nil {
+				if err := s.store.Delete(job.ID); err != nil {
+					log.Error("job %v: %v", job.ID, err)
+				}
+				continue
+			}
+			job.At = e.expr.Next(now)
+			if err := s.store.Save(job); err != nil {
+				log.Error("job %v: %v", job.ID, err)
+			}
+		}
+
+		s.jobs[job.ID] = e
+		s.schedule(e, job.At.Sub(now))
+	}
+	return nil
+}
+
+func newEntry(job *Job) (*entry, error) {
+	e := &entry{job: job}
+	if job.Cron != "" {
+		expr, err := timer.NewCronExpr(job.Cron)
+		if err != nil {
+			return nil, err
+		}
+		e.expr = expr
+	}
+	return e, nil
+}
+
+// the first run of a recurring job is the next time of its expression when
+// At is zero
+func (s *Scheduler) Add(job *Job) error {
+	if _, ok := s.jobs[job.ID]; ok {
+		return ErrExist
+	}
+
+	job = copyJob(job)
+	e, err := newEntry(job)
+	if err != nil {
+		return err
+	}
+	now := s.timers.Now()
+	if job.At.IsZero() && e.expr != nil {
+		job.At = e.expr.Next(now)
+	}
+	if job.At.IsZero() {
+		return fmt.Errorf("job %v: no time to run", job.ID)
+	}
+
+	err = s.store.Save(job)
+	if err != nil {
+		return err
+	}
+	s.jobs[job.ID] = e
+	s.schedule(e, job.At.Sub(now))
+	return nil
+}
+
+func (s *Scheduler) Remove(id string) error {
+	e, ok := s.jobs[id]
+	if !ok {
+		return ErrNotExist
+	}
+
+	err := s.store.Delete(id)
+	if err != nil {
+		return err
+	}
+	e.t.Stop()
+	delete(s.jobs, id)
+	return nil
+}
+
+// ordered by the next run
+func (s *Scheduler) Jobs() []*Job {
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, e := range s.jobs {
+		jobs = append(jobs, copyJob(e.job))
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].At.Before(jobs[j].At)
+	})
+	return jobs
+}
+
+// stops the timers, the jobs stay in the store and are loaded by Start
+func (s *Scheduler) Stop() {
+	for _, e := range s.jobs {
+		e.t.Stop()
+	}
+	s.jobs = make(map[string]*entry)
+	s.started = false
+}
+
+func (s *Scheduler) schedule(e *entry, d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	e.t = s.timers.AfterFunc(d, func() {
+		s.run(e)
+	})
+}
+
+func (s *Scheduler) run(e *entry) {
+	job := e.job
+
+	err := s.call(job)
+	if err != nil {
+		log.Error("job %v: %v", job.ID, err)
+		s.schedule(e, s.RetryInterval)
+		return
+	}
+
+	if e.expr == nil {
+		delete(s.jobs, job.ID)
+		if err := s.store.Delete(job.ID); err != nil {
+			log.Error("job %v: %v", job.ID, err)
+		}
+		return
+	}
+
+	now := s.timers.Now()
+	from := job.At
+	if job.Catchup != CatchupAll && from.Before(now) {
+		from = now
+	}
+	job.At = e.expr.Next(from)
+	if job.At.IsZero() {
+		delete(s.jobs, job.ID)
+		if err := s.store.Delete(job.ID); err != nil {
+			log.Error("job %v: %v", job.ID, err)
+		}
+		return
+	}
+
+	// the run is repeated on restart when the store fails
+	if err := s.store.Save(job); err != nil {
+		log.Error("job %v: %v", job.ID, err)
+	}
+	s.schedule(e, job.At.Sub(now))
+}
+
+func (s *Scheduler) call(job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if conf.LenStackBuf > 0 {
+				buf := make([]byte, conf.LenStackBuf)
+				l := runtime.Stack(buf, false)
+				err = fmt.Errorf("%v: %s", r, buf[:l])
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+
+	h, ok := s.handlers[job.Name]
+	if !ok {
+		return fmt.Errorf("job handler %v: not registered", job.Name)
+	}
+	return h(copyJob(job))
+}
+
+func copyJob(job *Job) *Job {
+	j := *job
+	j.Data = append([]byte(nil), job.Data...)
+	return &j
+}
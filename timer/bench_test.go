@@ -0,0 +1,58 @@
+package timer_test
+
+import (
+	"github.com/qumi/matrix/timer"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// schedules and stops buff-like timers, 1 second to 1 hour
+func benchmarkAfterFunc(b *testing.B, d *timer.Dispatcher) {
+	defer d.Close()
+
+	ts := make([]*timer.Timer, 0, b.N)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ts = append(ts, d.AfterFunc(time.Duration(1+rand.Intn(3600))*time.Second, func() {}))
+	}
+	for _, t := range ts {
+		t.Stop()
+	}
+}
+
+func BenchmarkDispatcherAfterFunc(b *testing.B) {
+	benchmarkAfterFunc(b, timer.NewDispatcher(0))
+}
+
+func BenchmarkWheelAfterFunc(b *testing.B) {
+	benchmarkAfterFunc(b, timer.NewWheelDispatcher(0, 10*time.Millisecond))
+}
+
+// 10000 timers firing within 100 milliseconds
+func benchmarkFire(b *testing.B, newDispatcher func() *timer.Dispatcher) {
+	const n = 10000
+
+	for i := 0; i < b.N; i++ {
+		d := newDispatcher()
+		for j := 0; j < n; j++ {
+			d.AfterFunc(time.Duration(rand.Intn(100))*time.Millisecond, func() {})
+		}
+		for j := 0; j < n; j++ {
+			(<-d.ChanTimer).Cb()
+		}
+		d.Close()
+	}
+}
+
+func BenchmarkDispatcherFire(b *testing.B) {
+	benchmarkFire(b, func() *timer.Dispatcher {
+		return timer.NewDispatcher(100)
+	})
+}
+
+func BenchmarkWheelFire(b *testing.B) {
+	benchmarkFire(b, func() *timer.Dispatcher {
+		return timer.NewWheelDispatcher(100, time.Millisecond)
+	})
+}
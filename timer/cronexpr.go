@@ -9,14 +9,22 @@ import (
 	"time"
 )
 
-// Field name   | Mandatory? | Allowed values | Allowed special characters
-// ----------   | ---------- | -------------- | --------------------------
-// Seconds      | No         | 0-59           | * / , -
-// Minutes      | Yes        | 0-59           | * / , -
-// Hours        | Yes        | 0-23           | * / , -
-// Day of month | Yes        | 1-31           | * / , -
-// Month        | Yes        | 1-12           | * / , -
-// Day of week  | Yes        | 0-6            | * / , -
+// Field name   | Mandatory? | Allowed values  | Allowed special characters
+// ----------   | ---------- | --------------  | --------------------------
+// Seconds      | No         | 0-59            | * / , -
+// Minutes      | Yes        | 0-59            | * / , -
+// Hours        | Yes        | 0-23            | * / , -
+// Day of month | Yes        | 1-31            | * / , - ? L W
+// Month        | Yes        | 1-12 or JAN-DEC | * / , -
+// Day of week  | Yes        | 0-7 or SUN-SAT  | * / , - ? L #
+//
+// L is the last day of the month, LW its last weekday and 15W the weekday
+// nearest to the 15th. 5L is the last Friday of the month and 5#3 the
+// third Friday. 0 and 7 are Sunday.
+//
+// The expression may be a descriptor instead: @yearly (or @annually),
+// @monthly, @weekly, @daily (or @midnight), @hourly or @every <duration>,
+// and may be prefixed by TZ=<location> to be scheduled in the location.
 type CronExpr struct {
 	sec   uint64
 	min   uint64
@@ -24,11 +32,82 @@ type CronExpr struct {
 	dom   uint64
 	month uint64
 	dow   uint64
+
+	// day of month: L, LW and the days of nW
+	lastDom     bool
+	lastWeekday bool
+	nearestDom  uint64
+	// day of week: the days of nL and bit dow*8+n of n#k
+	lastDow uint64
+	nthDow  uint64
+
+	every time.Duration
+	loc   *time.Location
 }
 
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+var (
+	monthNames = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+	dowNames   = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+)
+
 // goroutine safe
 func NewCronExpr(expr string) (cronExpr *CronExpr, err error) {
+	return NewCronExprIn(expr, nil)
+}
+
+// scheduled in loc, or in the location of the time passed to Next when
+// nil, a TZ= prefix of the expression takes precedence
+//
+// goroutine safe
+func NewCronExprIn(expr string, loc *time.Location) (cronExpr *CronExpr, err error) {
 	fields := strings.Fields(expr)
+
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "TZ=") {
+		loc, err = time.LoadLocation(fields[0][3:])
+		if err != nil {
+			err = fmt.Errorf("invalid expr %v: %v", expr, err)
+			return
+		}
+		fields = fields[1:]
+	}
+
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "@") {
+		if fields[0] == "@every" {
+			if len(fields) != 2 {
+				err = fmt.Errorf("invalid expr %v: expected @every <duration>", expr)
+				return
+			}
+			var every time.Duration
+			every, err = time.ParseDuration(fields[1])
+			if err != nil || every <= 0 {
+				err = fmt.Errorf("invalid expr %v: invalid duration %v", expr, fields[1])
+				return
+			}
+			if every < time.Second {
+				every = time.Second
+			}
+			cronExpr = &CronExpr{every: every.Truncate(time.Second), loc: loc}
+			return
+		}
+
+		descriptor, ok := cronDescriptors[fields[0]]
+		if !ok || len(fields) != 1 {
+			err = fmt.Errorf("invalid expr %v: unknown descriptor %v", expr, fields[0])
+			return
+		}
+		fields = strings.Fields(descriptor)
+	}
+
 	if len(fields) != 5 && len(fields) != 6 {
 		err = fmt.Errorf("invalid expr %v: expected 5 or 6 fields, got %v", expr, len(fields))
 		return
@@ -39,6 +118,7 @@ func NewCronExpr(expr string) (cronExpr *CronExpr, err error) {
 	}
 
 	cronExpr = new(CronExpr)
+	cronExpr.loc = loc
 	// Seconds
 	cronExpr.sec, err = parseCronField(fields[0], 0, 59)
 	if err != nil {
@@ -55,17 +135,17 @@ func NewCronExpr(expr string) (cronExpr *CronExpr, err error) {
 		goto onError
 	}
 	// Day of month
-	cronExpr.dom, err = parseCronField(fields[3], 1, 31)
+	err = cronExpr.parseDom(fields[3])
 	if err != nil {
 		goto onError
 	}
 	// Month
-	cronExpr.month, err = parseCronField(fields[4], 1, 12)
+	cronExpr.month, err = parseCronField(replaceNames(fields[4], monthNames, 1), 1, 12)
 	if err != nil {
 		goto onError
 	}
 	// Day of week
-	cronExpr.dow, err = parseCronField(fields[5], 0, 6)
+	err = cronExpr.parseDow(replaceNames(fields[5], dowNames, 0))
 	if err != nil {
 		goto onError
 	}
@@ -76,6 +156,83 @@ onError:
 	return
 }
 
+func replaceNames(field string, names []string, offset int) string {
+	field = strings.ToUpper(field)
+	for i, name := range names {
+		field = strings.Replace(field, name, strconv.Itoa(i+offset), -1)
+	}
+	return field
+}
+
+func (e *CronExpr) parseDom(field string) error {
+	if field == "?" {
+		field = "*"
+	}
+
+	for _, item := range strings.Split(field, ",") {
+		switch {
+		case item == "L":
+			e.lastDom = true
+		case item == "LW":
+			e.lastWeekday = true
+		case strings.HasSuffix(item, "W"):
+			day, err := strconv.Atoi(item[:len(item)-1])
+			if err != nil || day < 1 || day > 31 {
+				return fmt.Errorf("invalid day: %v", item)
+			}
+			e.nearestDom |= 1 << uint(day)
+		default:
+			dom, err := parseCronField(item, 1, 31)
+			if err != nil {
+				return err
+			}
+			e.dom |= dom
+		}
+	}
+
+	return nil
+}
+
+func (e *CronExpr) parseDow(field string) error {
+	if field == "?" {
+		field = "*"
+	}
+
+	for _, item := range strings.Split(field, ",") {
+		switch {
+		case strings.HasSuffix(item, "L"):
+			dow, err := strconv.Atoi(item[:len(item)-1])
+			if err != nil || dow < 0 || dow > 7 {
+				return fmt.Errorf("invalid day of week: %v", item)
+			}
+			e.lastDow |= 1 << uint(dow%7)
+		case strings.Contains(item, "#"):
+			dowAndNth := strings.Split(item, "#")
+			dow, err := strconv.Atoi(dowAndNth[0])
+			if err != nil || len(dowAndNth) != 2 || dow < 0 || dow > 7 {
+				return fmt.Errorf("invalid day of week: %v", item)
+			}
+			nth, err := strconv.Atoi(dowAndNth[1])
+			if err != nil || nth < 1 || nth > 5 {
+				return fmt.Errorf("invalid day of week: %v", item)
+			}
+			e.nthDow |= 1 << uint(dow%7*8+nth)
+		default:
+			dow, err := parseCronField(item, 0, 7)
+			if err != nil {
+				return err
+			}
+			e.dow |= dow
+		}
+	}
+
+	// Sunday
+	if e.dow&(1<<7) != 0 {
+		e.dow = e.dow&0x7f | 1
+	}
+	return nil
+}
+
 // 1. *
 // 2. num
 // 3. num-num
@@ -171,23 +328,88 @@ func parseCronField(field string, min int, max int) (cronField uint64, err error
 	return
 }
 
+func daysIn(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+}
+
+// the weekday nearest to the day in the month of t
+func nearestWeekday(t time.Time, day int, last int) int {
+	if day > last {
+		day = last
+	}
+	switch time.Date(t.Year(), t.Month(), day, 0, 0, 0, 0, t.Location()).Weekday() {
+	case time.Saturday:
+		if day == 1 {
+			return day + 2
+		}
+		return day - 1
+	case time.Sunday:
+		if day == last {
+			return day - 2
+		}
+		return day + 1
+	}
+	return day
+}
+
+func (e *CronExpr) matchDom(t time.Time) bool {
+	day := t.Day()
+	if 1<<uint(day)&e.dom != 0 {
+		return true
+	}
+
+	last := daysIn(t)
+	if e.lastDom && day == last {
+		return true
+	}
+	if e.lastWeekday && day == nearestWeekday(t, last, last) {
+		return true
+	}
+	for n := 1; n <= 31 && e.nearestDom != 0; n++ {
+		if 1<<uint(n)&e.nearestDom != 0 && day == nearestWeekday(t, n, last) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *CronExpr) matchDow(t time.Time) bool {
+	dow := uint(t.Weekday())
+	if 1<<dow&e.dow != 0 {
+		return true
+	}
+
+	day := t.Day()
+	if 1<<dow&e.lastDow != 0 && day+7 > daysIn(t) {
+		return true
+	}
+	return 1<<(dow*8+uint(day-1)/7+1)&e.nthDow != 0
+}
+
 func (e *CronExpr) matchDay(t time.Time) bool {
 	// day-of-month blank
-	if e.dom == 0xfffffffe {
-		return 1<<uint(t.Weekday())&e.dow != 0
+	if e.dom == 0xfffffffe && !e.lastDom && !e.lastWeekday && e.nearestDom == 0 {
+		return e.matchDow(t)
 	}
 
 	// day-of-week blank
-	if e.dow == 0x7f {
-		return 1<<uint(t.Day())&e.dom != 0
+	if e.dow == 0x7f && e.lastDow == 0 && e.nthDow == 0 {
+		return e.matchDom(t)
 	}
 
-	return 1<<uint(t.Weekday())&e.dow != 0 ||
-		1<<uint(t.Day())&e.dom != 0
+	return e.matchDow(t) || e.matchDom(t)
 }
 
 // goroutine safe
 func (e *CronExpr) Next(t time.Time) time.Time {
+	if e.loc != nil {
+		t = t.In(e.loc)
+	}
+
+	if e.every > 0 {
+		return t.Truncate(time.Second).Add(e.every)
+	}
+
 	// the upcoming second
 	t = t.Truncate(time.Second).Add(time.Second)
 
@@ -230,7 +452,7 @@ retry:
 	for 1<<uint(t.Hour())&e.hour == 0 {
 		if !initFlag {
 			initFlag = true
-			t = t.Truncate(time.Hour)
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
 		}
 
 		t = t.Add(time.Hour)
@@ -243,7 +465,7 @@ retry:
 	for 1<<uint(t.Minute())&e.min == 0 {
 		if !initFlag {
 			initFlag = true
-			t = t.Truncate(time.Minute)
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, t.Location())
 		}
 
 		t = t.Add(time.Minute)
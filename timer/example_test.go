@@ -2,7 +2,9 @@ package timer_test
 
 import (
 	"fmt"
+	"github.com/qumi/matrix/clock"
 	"github.com/qumi/matrix/timer"
+	"runtime"
 	"time"
 )
 
@@ -43,6 +45,36 @@ func ExampleCronExpr() {
 	// 2000-01-01 21:00:00 +0000 UTC
 }
 
+func ExampleNewCronExprIn() {
+	now := time.Date(2000, 1, 1, 20, 10, 5, 0, time.UTC)
+
+	for _, expr := range []string{
+		"@daily",
+		"@every 90s",
+		"0 18 * * FRIL",
+		"0 9 * MAR-MAY MON#2",
+		"0 0 LW * ?",
+		"0 0 15W FEB *",
+		"TZ=Asia/Tokyo 0 10 * * *",
+	} {
+		cronExpr, err := timer.NewCronExprIn(expr, time.UTC)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(cronExpr.Next(now))
+	}
+
+	// Output:
+	// 2000-01-02 00:00:00 +0000 UTC
+	// 2000-01-01 20:11:35 +0000 UTC
+	// 2000-01-28 18:00:00 +0000 UTC
+	// 2000-03-13 09:00:00 +0000 UTC
+	// 2000-01-31 00:00:00 +0000 UTC
+	// 2000-02-15 00:00:00 +0000 UTC
+	// 2000-01-02 10:00:00 +0900 JST
+}
+
 func ExampleCron() {
 	d := timer.NewDispatcher(10)
 
@@ -65,3 +97,110 @@ func ExampleCron() {
 	// Output:
 	// My name is matrix
 }
+
+func ExampleNewWheelDispatcher() {
+	d := timer.NewWheelDispatcher(10, time.Millisecond)
+	defer d.Close()
+
+	d.AfterFunc(20*time.Millisecond, func() {
+		fmt.Println("second")
+	})
+	d.AfterFunc(10*time.Millisecond, func() {
+		fmt.Println("first")
+	})
+	t := d.AfterFunc(15*time.Millisecond, func() {
+		fmt.Println("will not print")
+	})
+	t.Stop()
+
+	// dispatch
+	(<-d.ChanTimer).Cb()
+	(<-d.ChanTimer).Cb()
+
+	// Output:
+	// first
+	// second
+}
+
+func ExampleGroup() {
+	c := clock.NewFake(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	d := timer.NewDispatcherClock(10, c)
+	dispatch := func(dt time.Duration) {
+		c.Advance(dt)
+		for len(d.ChanTimer) > 0 {
+			(<-d.ChanTimer).Cb()
+		}
+	}
+
+	// timers of a player
+	g := d.NewGroup()
+	g.AfterFunc(10*time.Second, func() {
+		fmt.Println("buff expired")
+	})
+	g.TickerFunc(3*time.Second, time.Second, func() {
+		fmt.Println("regen")
+	})
+	for _, info := range g.List() {
+		fmt.Println(info.Kind, info.Next.Sub(c.Now()) <= 4*time.Second)
+	}
+
+	dispatch(5 * time.Second)
+	g.Pause()
+	dispatch(time.Hour)
+	g.Resume()
+	dispatch(5 * time.Second)
+
+	// leaving
+	g.Stop()
+	dispatch(time.Hour)
+	fmt.Println(g.Len())
+
+	// Output:
+	// ticker true
+	// timer false
+	// regen
+	// regen
+	// buff expired
+	// 0
+}
+
+func ExampleGroup_CronFunc() {
+	c := clock.NewFake(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	d := timer.NewDispatcherClock(10, c)
+	g := d.NewGroup()
+
+	// no leap day within a year of 2000-02-29, the cron ends
+	cronExpr, _ := timer.NewCronExpr("0 0 0 29 2 *")
+	g.CronFunc(cronExpr, func() {
+		fmt.Println("leap day")
+	})
+	fmt.Println(g.Len())
+
+	c.Advance(60 * 24 * time.Hour)
+	(<-d.ChanTimer).Cb()
+	fmt.Println(g.Len(), len(g.List()))
+
+	// Output:
+	// 1
+	// leap day
+	// 0 0
+}
+
+func ExampleDispatcher_Close() {
+	goroutines := runtime.NumGoroutine()
+
+	c := clock.NewFake(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	d := timer.NewDispatcherClock(1, c)
+	for i := 1; i <= 3; i++ {
+		d.AfterFunc(time.Duration(i)*time.Second, func() {})
+	}
+	c.Advance(time.Minute)
+
+	// the timers not received are dropped
+	d.Close()
+	time.Sleep(10 * time.Millisecond)
+	fmt.Println(len(d.ChanTimer), runtime.NumGoroutine() <= goroutines)
+
+	// Output:
+	// 1 true
+}
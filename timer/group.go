@@ -0,0 +1,185 @@
+package timer
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Ticker
+type Ticker struct {
+	t     *Timer
+	group *Group
+}
+
+func (tk *Ticker) Stop() {
+	if tk.t != nil {
+		tk.t.Stop()
+	}
+	if tk.group != nil {
+		delete(tk.group.tickers, tk)
+		tk.group = nil
+	}
+}
+
+// calls cb every d plus a random duration in [-jitter, jitter], so tickers
+// started together spread out
+func (disp *Dispatcher) TickerFunc(d time.Duration, jitter time.Duration, _cb func()) *Ticker {
+	if d <= 0 {
+		panic("non-positive interval for TickerFunc")
+	}
+
+	tk := new(Ticker)
+	interval := func() time.Duration {
+		if jitter <= 0 {
+			return d
+		}
+		i := d + time.Duration(rand.Int63n(int64(2*jitter)+1)) - jitter
+		if i < 0 {
+			return 0
+		}
+		return i
+	}
+
+	// callback
+	var cb func()
+	cb = func() {
+		defer _cb()
+		tk.t = disp.AfterFunc(interval(), cb)
+	}
+
+	tk.t = disp.AfterFunc(interval(), cb)
+	return tk
+}
+
+type TimerInfo struct {
+	// timer, cron or ticker
+	Kind   string
+	Next   time.Time
+	Paused bool
+}
+
+// timers of an entity, stopped, paused or resumed at once
+//
+// one group per goroutine of the dispatcher (goroutine not safe)
+type Group struct {
+	disp    *Dispatcher
+	timers  map[*Timer]struct{}
+	crons   map[*Cron]struct{}
+	tickers map[*Ticker]struct{}
+	paused  bool
+}
+
+func (disp *Dispatcher) NewGroup() *Group {
+	g := new(Group)
+	g.disp = disp
+	g.timers = make(map[*Timer]struct{})
+	g.crons = make(map[*Cron]struct{})
+	g.tickers = make(map[*Ticker]struct{})
+	return g
+}
+
+// paused when the group is
+func (g *Group) AfterFunc(d time.Duration, cb func()) *Timer {
+	t := g.disp.AfterFunc(d, cb)
+	t.group = g
+	g.timers[t] = struct{}{}
+	if g.paused {
+		t.pause()
+	}
+	return t
+}
+
+// paused when the group is
+func (g *Group) CronFunc(cronExpr *CronExpr, cb func()) *Cron {
+	c := g.disp.CronFunc(cronExpr, cb)
+	if c.t == nil {
+		return c
+	}
+	c.group = g
+	g.crons[c] = struct{}{}
+	if g.paused {
+		c.t.pause()
+	}
+	return c
+}
+
+// paused when the group is
+func (g *Group) TickerFunc(d time.Duration, jitter time.Duration, cb func()) *Ticker {
+	tk := g.disp.TickerFunc(d, jitter, cb)
+	tk.group = g
+	g.tickers[tk] = struct{}{}
+	if g.paused {
+		tk.t.pause()
+	}
+	return tk
+}
+
+func (g *Group) Len() int {
+	return len(g.timers) + len(g.crons) + len(g.tickers)
+}
+
+// ordered by the next run
+func (g *Group) List() []TimerInfo {
+	infos := make([]TimerInfo, 0, g.Len())
+	info := func(kind string, t *Timer) TimerInfo {
+		next := t.when
+		if t.paused {
+			next = g.disp.clock.Now().Add(t.remaining)
+		}
+		return TimerInfo{Kind: kind, Next: next, Paused: t.paused}
+	}
+	for t := range g.timers {
+		infos = append(infos, info("timer", t))
+	}
+	for c := range g.crons {
+		infos = append(infos, info("cron", c.t))
+	}
+	for tk := range g.tickers {
+		infos = append(infos, info("ticker", tk.t))
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Next.Before(infos[j].Next)
+	})
+	return infos
+}
+
+func (g *Group) Stop() {
+	for t := range g.timers {
+		t.Stop()
+	}
+	for c := range g.crons {
+		c.Stop()
+	}
+	for tk := range g.tickers {
+		tk.Stop()
+	}
+}
+
+// the remaining time to the next run is kept until Resume
+func (g *Group) Pause() {
+	g.paused = true
+	for t := range g.timers {
+		t.pause()
+	}
+	for c := range g.crons {
+		c.t.pause()
+	}
+	for tk := range g.tickers {
+		tk.t.pause()
+	}
+}
+
+func (g *Group) Resume() {
+	g.paused = false
+	for t := range g.timers {
+		t.resume()
+	}
+	for c := range g.crons {
+		c.t.resume()
+	}
+	for tk := range g.tickers {
+		tk.t.resume()
+	}
+}
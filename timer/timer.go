@@ -1,35 +1,183 @@
 package timer
 
 import (
+	"github.com/qumi/matrix/clock"
 	"github.com/qumi/matrix/conf"
 	"github.com/qumi/matrix/log"
 	"runtime"
+	"sync"
 	"time"
 )
 
 // one dispatcher per goroutine (goroutine not safe)
 type Dispatcher struct {
 	ChanTimer chan *Timer
+	clock     clock.Clock
+	wheel     *wheel
+
+	// timers fired while ChanTimer is full, in firing order
+	mutex    sync.Mutex
+	overflow []*Timer
+	closed   bool
+	closeSig chan bool
 }
 
 func NewDispatcher(l int) *Dispatcher {
+	return NewDispatcherClock(l, clock.Real)
+}
+
+// timers of the clock, a clock.Fake fires them deterministically
+func NewDispatcherClock(l int, c clock.Clock) *Dispatcher {
 	disp := new(Dispatcher)
 	disp.ChanTimer = make(chan *Timer, l)
+	disp.clock = c
+	disp.closeSig = make(chan bool)
 	return disp
 }
 
+// never blocks, the callbacks of a fake clock run on the goroutine
+// advancing it
+func (disp *Dispatcher) fire(t *Timer) {
+	disp.mutex.Lock()
+	defer disp.mutex.Unlock()
+
+	if disp.closed {
+		return
+	}
+	if len(disp.overflow) == 0 {
+		select {
+		case disp.ChanTimer <- t:
+			return
+		default:
+		}
+		go disp.drain()
+	}
+	disp.overflow = append(disp.overflow, t)
+}
+
+func (disp *Dispatcher) drain() {
+	disp.mutex.Lock()
+	for len(disp.overflow) > 0 {
+		t := disp.overflow[0]
+		disp.mutex.Unlock()
+		select {
+		case disp.ChanTimer <- t:
+		case <-disp.closeSig:
+			return
+		}
+		disp.mutex.Lock()
+		disp.overflow = disp.overflow[1:]
+	}
+	disp.overflow = nil
+	disp.mutex.Unlock()
+}
+
+func (disp *Dispatcher) Now() time.Time {
+	return disp.clock.Now()
+}
+
+// stops the timing wheel and drops the timers fired but not received
+func (disp *Dispatcher) Close() {
+	disp.mutex.Lock()
+	defer disp.mutex.Unlock()
+
+	if disp.closed {
+		return
+	}
+	disp.closed = true
+	close(disp.closeSig)
+	disp.overflow = nil
+	if disp.wheel != nil {
+		disp.wheel.close()
+	}
+}
+
 // Timer
 type Timer struct {
-	t  *time.Timer
-	cb func()
+	t    clock.Timer
+	cb   func()
+	disp *Dispatcher
+	when time.Time
+
+	// paused by a group, fired while paused
+	paused    bool
+	fired     bool
+	remaining time.Duration
+	group     *Group
+
+	// timing wheel
+	w      *wheel
+	expire uint64
+	bucket *bucket
+	prev   *Timer
+	next   *Timer
 }
 
 func (t *Timer) Stop() {
-	t.t.Stop()
+	t.disarm()
 	t.cb = nil
+	if t.group != nil {
+		delete(t.group.timers, t)
+		t.group = nil
+	}
+}
+
+func (t *Timer) arm(d time.Duration) {
+	t.when = t.disp.clock.Now().Add(d)
+	if t.w != nil {
+		t.w.afterFunc(t, d)
+		return
+	}
+	t.t = t.disp.clock.AfterFunc(d, func() {
+		t.disp.fire(t)
+	})
+}
+
+func (t *Timer) disarm() {
+	if t.w != nil {
+		t.w.remove(t)
+	} else if t.t != nil {
+		t.t.Stop()
+	}
+}
+
+func (t *Timer) pause() {
+	if t.paused || t.cb == nil {
+		return
+	}
+	t.paused = true
+	t.disarm()
+	t.remaining = t.when.Sub(t.disp.clock.Now())
+	if t.remaining < 0 {
+		t.remaining = 0
+	}
+}
+
+func (t *Timer) resume() {
+	if !t.paused {
+		return
+	}
+	t.paused = false
+	if t.fired {
+		t.fired = false
+		t.remaining = 0
+	}
+	if t.cb != nil {
+		t.arm(t.remaining)
+	}
 }
 
 func (t *Timer) Cb() {
+	// delivered again on resume
+	if t.paused {
+		t.fired = true
+		return
+	}
+	if t.group != nil {
+		delete(t.group.timers, t)
+		t.group = nil
+	}
+
 	defer func() {
 		t.cb = nil
 		if r := recover(); r != nil {
@@ -51,27 +199,32 @@ func (t *Timer) Cb() {
 func (disp *Dispatcher) AfterFunc(d time.Duration, cb func()) *Timer {
 	t := new(Timer)
 	t.cb = cb
-	t.t = time.AfterFunc(d, func() {
-		disp.ChanTimer <- t
-	})
+	t.disp = disp
+	t.w = disp.wheel
+	t.arm(d)
 	return t
 }
 
 // Cron
 type Cron struct {
-	t *Timer
+	t     *Timer
+	group *Group
 }
 
 func (c *Cron) Stop() {
 	if c.t != nil {
 		c.t.Stop()
 	}
+	if c.group != nil {
+		delete(c.group.crons, c)
+		c.group = nil
+	}
 }
 
 func (disp *Dispatcher) CronFunc(cronExpr *CronExpr, _cb func()) *Cron {
 	c := new(Cron)
 
-	now := time.Now()
+	now := disp.clock.Now()
 	nextTime := cronExpr.Next(now)
 	if nextTime.IsZero() {
 		return c
@@ -82,9 +235,15 @@ func (disp *Dispatcher) CronFunc(cronExpr *CronExpr, _cb func()) *Cron {
 	cb = func() {
 		defer _cb()
 
-		now := time.Now()
+		now := disp.clock.Now()
 		nextTime := cronExpr.Next(now)
 		if nextTime.IsZero() {
+			// ended, no longer in its group
+			c.t = nil
+			if c.group != nil {
+				delete(c.group.crons, c)
+				c.group = nil
+			}
 			return
 		}
 		c.t = disp.AfterFunc(nextTime.Sub(now), cb)
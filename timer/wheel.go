@@ -0,0 +1,237 @@
+package timer
+
+import (
+	"github.com/qumi/matrix/clock"
+	"sync"
+	"time"
+)
+
+// hierarchical timing wheel, 256 slots of one tick then 4 levels of 64
+// slots each, timers beyond 2^32 ticks are put in the last slot of the last
+// level until they are within reach
+const (
+	wheelBits0  = 8
+	wheelBits   = 6
+	wheelLevels = 5
+	wheelMax    = 1<<(wheelBits0+wheelBits*(wheelLevels-1)) - 1
+)
+
+type bucket struct {
+	head *Timer
+}
+
+type wheel struct {
+	sync.Mutex
+	clock    clock.Clock
+	tick     time.Duration
+	start    time.Time
+	now      uint64
+	buckets  [wheelLevels][]bucket
+	closeSig chan bool
+	// timers in the buckets, the ticker is stopped while there are none
+	count int
+	wake  chan bool
+}
+
+// timers run on a granularity of tick, started on a goroutine delivering
+// into ChanTimer until Close is called
+func NewWheelDispatcher(l int, tick time.Duration) *Dispatcher {
+	return NewWheelDispatcherClock(l, tick, clock.Real)
+}
+
+func NewWheelDispatcherClock(l int, tick time.Duration, c clock.Clock) *Dispatcher {
+	if tick <= 0 {
+		tick = 10 * time.Millisecond
+	}
+
+	w := new(wheel)
+	w.clock = c
+	w.tick = tick
+	w.start = c.Now()
+	w.closeSig = make(chan bool)
+	w.wake = make(chan bool, 1)
+	w.buckets[0] = make([]bucket, 1<<wheelBits0)
+	for i := 1; i < wheelLevels; i++ {
+		w.buckets[i] = make([]bucket, 1<<wheelBits)
+	}
+
+	disp := NewDispatcherClock(l, c)
+	disp.wheel = w
+	go w.run(disp.ChanTimer)
+	return disp
+}
+
+// ticks since the start, rounded up
+func (w *wheel) ticks(t time.Time) uint64 {
+	return uint64((t.Sub(w.start) + w.tick - 1) / w.tick)
+}
+
+func (w *wheel) afterFunc(t *Timer, d time.Duration) {
+	w.Lock()
+	defer w.Unlock()
+
+	w.unlink(t)
+	now := w.clock.Now()
+	if w.count == 0 {
+		// the buckets are empty, skip the ticks while idle
+		if tick := uint64(now.Sub(w.start) / w.tick); tick > w.now {
+			w.now = tick
+		}
+		select {
+		case w.wake <- true:
+		default:
+		}
+	}
+	w.count++
+
+	t.expire = w.ticks(now.Add(d))
+	w.add(t)
+}
+
+func (w *wheel) add(t *Timer) {
+	if t.expire < w.now {
+		t.expire = w.now
+	}
+	// cascaded again until within reach
+	slot := t.expire
+	delta := slot - w.now
+	if delta > wheelMax {
+		slot = w.now + wheelMax
+		delta = wheelMax
+	}
+
+	var b *bucket
+	if delta < 1<<wheelBits0 {
+		b = &w.buckets[0][slot&(1<<wheelBits0-1)]
+	} else {
+		level := 1
+		for delta >= 1<<(wheelBits0+wheelBits*level) {
+			level++
+		}
+		shift := wheelBits0 + wheelBits*(level-1)
+		b = &w.buckets[level][(slot>>shift)&(1<<wheelBits-1)]
+	}
+
+	t.bucket = b
+	t.prev = nil
+	t.next = b.head
+	if b.head != nil {
+		b.head.prev = t
+	}
+	b.head = t
+}
+
+func (w *wheel) remove(t *Timer) {
+	w.Lock()
+	defer w.Unlock()
+
+	w.unlink(t)
+}
+
+func (w *wheel) unlink(t *Timer) {
+	b := t.bucket
+	if b == nil {
+		return
+	}
+
+	if t.prev != nil {
+		t.prev.next = t.next
+	} else {
+		b.head = t.next
+	}
+	if t.next != nil {
+		t.next.prev = t.prev
+	}
+	w.count--
+	t.bucket = nil
+	t.prev = nil
+	t.next = nil
+}
+
+// moves the timers of a slot of level to lower levels
+func (w *wheel) cascade(level int) uint64 {
+	shift := wheelBits0 + wheelBits*(level-1)
+	index := (w.now >> shift) & (1<<wheelBits - 1)
+
+	b := &w.buckets[level][index]
+	t := b.head
+	b.head = nil
+	for t != nil {
+		next := t.next
+		w.add(t)
+		t = next
+	}
+	return index
+}
+
+// expired timers up to the tick, idle when no timers are left
+func (w *wheel) advance(tick uint64, expired []*Timer) ([]*Timer, bool) {
+	w.Lock()
+	defer w.Unlock()
+
+	for ; w.now <= tick; w.now++ {
+		index := w.now & (1<<wheelBits0 - 1)
+		if index == 0 {
+			for level := 1; level < wheelLevels && w.cascade(level) == 0; level++ {
+			}
+		}
+
+		b := &w.buckets[0][index]
+		for t := b.head; t != nil; {
+			next := t.next
+			t.bucket = nil
+			t.prev = nil
+			t.next = nil
+			expired = append(expired, t)
+			w.count--
+			t = next
+		}
+		b.head = nil
+	}
+	return expired, w.count == 0
+}
+
+func (w *wheel) run(chanTimer chan *Timer) {
+	var expired []*Timer
+	for {
+		select {
+		case <-w.closeSig:
+			return
+		case <-w.wake:
+		}
+
+		if !w.tickUntilIdle(chanTimer, expired) {
+			return
+		}
+	}
+}
+
+// false once closed
+func (w *wheel) tickUntilIdle(chanTimer chan *Timer, expired []*Timer) bool {
+	ticker := w.clock.NewTicker(w.tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.closeSig:
+			return false
+		case now := <-ticker.C():
+			var idle bool
+			expired, idle = w.advance(uint64(now.Sub(w.start)/w.tick), expired[:0])
+			for _, t := range expired {
+				select {
+				case chanTimer <- t:
+				case <-w.closeSig:
+					return false
+				}
+			}
+			if idle {
+				return true
+			}
+		}
+	}
+}
+
+func (w *wheel) close() {
+	close(w.closeSig)
+}
@@ -0,0 +1,40 @@
+package util
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+)
+
+// id of the calling goroutine, parsed from its stack trace
+func GoroutineID() int64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	b := bytes.TrimPrefix(buf[:n], []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		id, _ := strconv.ParseInt(string(b[:i]), 10, 64)
+		return id
+	}
+	return 0
+}
+
+// stack trace of the goroutine, nil if it does not exist
+func GoroutineStack(id int64) []byte {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	prefix := []byte("goroutine " + strconv.FormatInt(id, 10) + " [")
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.HasPrefix(stack, prefix) {
+			return stack
+		}
+	}
+	return nil
+}